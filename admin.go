@@ -0,0 +1,119 @@
+package gohan
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/appnaconda/gohan/logger"
+	"github.com/appnaconda/gohan/response"
+	"github.com/appnaconda/gohan/router"
+)
+
+// Admin serves the internal endpoints of the service (metrics, profiling, route
+// dumps, log level, ...) on a separate listener, so they are not reachable from
+// the public port.
+type Admin struct {
+	// Address of the admin listener (e.g. 127.0.0.1:9090). When empty, the admin
+	// endpoints aren't served, Handler can still be mounted explicitly behind a guard.
+	Addr string
+
+	service     *Service
+	router      *router.Router
+	middlewares middlewareList
+}
+
+func newAdmin(s *Service) *Admin {
+	a := &Admin{
+		service: s,
+		router:  router.New(),
+	}
+
+	a.GET("/routes", a.routes)
+	a.GET("/loglevel", a.getLogLevel)
+	a.PUT("/loglevel", a.setLogLevel)
+
+	return a
+}
+
+// Use adds middlewares applied to every admin endpoint, e.g. authentication.
+// It panics once the service started serving.
+func (a *Admin) Use(middlewares ...MiddlewareFunc) {
+	a.middlewares.add(middlewares)
+}
+
+func (a *Admin) GET(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return a.Handle(http.MethodGet, path, handle, middlewares...)
+}
+
+func (a *Admin) POST(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return a.Handle(http.MethodPost, path, handle, middlewares...)
+}
+
+func (a *Admin) PUT(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return a.Handle(http.MethodPut, path, handle, middlewares...)
+}
+
+func (a *Admin) Handle(method string, path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	name := GetFuncName(handle)
+	route := &Route{Method: method, Pattern: path, Handler: name}
+
+	handle = a.service.authorize(route, handle)
+	for _, middleware := range middlewares {
+		handle = middleware(handle)
+	}
+
+	// The admin middlewares are applied on the first request so they
+	// can be added after the endpoints.
+	a.router.Handle(method, path, a.service.wrapHandle(name, a.middlewares.wrap(handle)))
+
+	return route
+}
+
+// HandleHTTP registers a http.Handler as a GET admin endpoint.
+func (a *Admin) HandleHTTP(path string, h http.Handler) {
+	a.GET(path, func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(w, req)
+	})
+}
+
+// Handler returns the http handler serving the admin endpoints.
+func (a *Admin) Handler() http.Handler {
+	return a.router
+}
+
+// routes lists the routes of the service with their authorization rules.
+func (a *Admin) routes(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+	response.JSON(w, a.service.Routes(), http.StatusOK)
+}
+
+type logLevelBody struct {
+	Level string `json:"level"`
+}
+
+func (a *Admin) getLogLevel(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+	response.JSON(w, logLevelBody{Level: a.service.LogLevel().String()}, http.StatusOK)
+}
+
+// setLogLevel changes the service log level, e.g. {"level": "INFO"}.
+func (a *Admin) setLogLevel(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+	var body logLevelBody
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		response.String(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	level, ok := logger.ParseLevel(strings.ToUpper(body.Level))
+	if !ok {
+		response.String(w, "invalid log level: "+body.Level, http.StatusBadRequest)
+		return
+	}
+
+	if err := a.service.SetLogLevel(level); err != nil {
+		response.String(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sc.Logger.Infof("log level changed to %s", level)
+	response.JSON(w, logLevelBody{Level: level.String()}, http.StatusOK)
+}
@@ -0,0 +1,120 @@
+package gohan
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appnaconda/gohan/logger"
+)
+
+func TestAdminNotPublic(t *testing.T) {
+	s := newTestService(t)
+	s.GET("/users", func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {})
+
+	// The admin endpoints are never served by the service listener
+	for _, path := range []string{"/routes", "/loglevel"} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET %s - Expecting: 404; Got: %d", path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.Admin.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/routes", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Admin GET /routes - Expecting: 200; Got: %d", w.Code)
+	}
+
+	var routes []struct{ Method, Pattern string }
+	json.Unmarshal(w.Body.Bytes(), &routes)
+
+	if len(routes) != 1 || routes[0].Pattern != "/users" {
+		t.Errorf("Admin GET /routes - Expecting: /users; Got: %v", routes)
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	s := newTestService(t)
+
+	w := httptest.NewRecorder()
+	s.Admin.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/loglevel", strings.NewReader(`{"level":"warn"}`)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT /loglevel - Expecting: 200; Got: %d %s", w.Code, w.Body.String())
+	}
+
+	if s.LogLevel() != logger.WARN {
+		t.Errorf("Log level - Expecting: WARN; Got: %s", s.LogLevel())
+	}
+
+	w = httptest.NewRecorder()
+	s.Admin.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/loglevel", strings.NewReader(`{"level":"verbose"}`)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("PUT /loglevel invalid - Expecting: 400; Got: %d", w.Code)
+	}
+}
+
+func TestAdminListener(t *testing.T) {
+	adminLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminAddr := adminLn.Addr().String()
+	adminLn.Close()
+
+	s := newTestService(t)
+	s.Admin.Addr = adminAddr
+
+	var calls int
+	s.Admin.Use(func(next HandlerFunc) HandlerFunc {
+		return func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+			calls++
+			next(sc, w, req)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := serveTest(t, s, ctx)
+
+	// The admin listener is created by Serve, wait for it
+	var res *http.Response
+	for i := 0; i < 100; i++ {
+		if res, err = http.Get("http://" + adminAddr + "/loglevel"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err != nil {
+		t.Fatalf("GET /loglevel - Expecting: nil; Got: %s", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), "DEBUG") {
+		t.Errorf("GET /loglevel - Expecting: 200 DEBUG; Got: %d %s", res.StatusCode, body)
+	}
+
+	if calls != 1 {
+		t.Errorf("Admin middlewares - Expecting: 1 call; Got: %d", calls)
+	}
+
+	cancel()
+	<-done
+
+	// The admin listener is shutdown along with the service
+	if _, err := http.Get("http://" + adminAddr + "/loglevel"); err == nil {
+		t.Errorf("GET /loglevel after shutdown - Expecting: error; Got: nil")
+	}
+}
@@ -0,0 +1,204 @@
+// Package apikey contains a middleware authenticating machine clients with API keys.
+//
+// A key has the form <id>.<secret>. The id is used to look up the key in the store,
+// only a hash of the whole key is stored:
+//
+//	plain, key, err := apikey.Generate("live_", "billing-service", "invoices:read")
+//	...
+//	store := apikey.NewMemoryStore(key)
+//	service.Use(apikey.New(apikey.Config{Store: store}))
+//
+// The key owner is available in ServiceContext.LoggedUserIdentifier and its scopes in
+// the scope claim of ServiceContext.Claims, so the routes can be authorized with
+// gohan.RequireScopes.
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/logger"
+	"github.com/appnaconda/gohan/response"
+)
+
+// DefaultHeader is the header containing the key when none is configured.
+const DefaultHeader = "X-API-Key"
+
+// Errors of the key verification.
+var (
+	// Returned by the stores when no key has the given id.
+	ErrNotFound = errors.New("api key not found")
+	ErrExpired  = errors.New("api key expired")
+)
+
+// Key is a stored API key.
+type Key struct {
+	// Public part of the key, used to look it up.
+	ID string `json:"id"`
+
+	// Hash of the whole key, see Hash.
+	Hash string `json:"hash"`
+
+	// Client owning the key.
+	Owner string `json:"owner"`
+
+	Scopes []string `json:"scopes,omitempty"`
+
+	// The key is rejected after this time. Zero means it never expires.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports if the key is expired at the given time.
+func (k Key) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// Hash returns the hex encoded SHA-256 of the key. The keys are random, so a fast
+// hash is enough.
+func Hash(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate creates a new key for the owner. The plain key must be given to the client,
+// only the returned Key is stored.
+func Generate(prefix, owner string, scopes ...string) (string, Key, error) {
+	id, err := gohan.GenerateRandomBytes(6)
+	if err != nil {
+		return "", Key{}, err
+	}
+
+	secret, err := gohan.GenerateRandomString(30)
+	if err != nil {
+		return "", Key{}, err
+	}
+
+	key := Key{ID: prefix + hex.EncodeToString(id), Owner: owner, Scopes: scopes}
+	plain := key.ID + "." + secret
+	key.Hash = Hash(plain)
+
+	return plain, key, nil
+}
+
+// Split returns the id and the secret of a plain key.
+func Split(plain string) (id, secret string, ok bool) {
+	i := strings.LastIndex(plain, ".")
+	if i <= 0 || i == len(plain)-1 {
+		return "", "", false
+	}
+
+	return plain[:i], plain[i+1:], true
+}
+
+// Config contains the settings of the middleware.
+type Config struct {
+	// Where the keys are looked up.
+	Store KeyStore
+
+	// Header containing the key. Defaults to DefaultHeader.
+	Header string
+
+	// Query parameter containing the key. The query isn't read when empty, keys in
+	// urls end up in the access logs.
+	Query string
+
+	// Lets the requests without key through unauthenticated. Requests with an
+	// invalid key are still rejected.
+	Optional bool
+
+	// used by the tests
+	now func() time.Time
+}
+
+// New returns a middleware rejecting the requests without a valid API key with a 401
+// problem response.
+func New(config Config) gohan.MiddlewareFunc {
+	if config.Store == nil {
+		panic("apikey - no store was provided")
+	}
+
+	if config.Header == "" {
+		config.Header = DefaultHeader
+	}
+
+	if config.now == nil {
+		config.now = time.Now
+	}
+
+	return func(next gohan.HandlerFunc) gohan.HandlerFunc {
+		return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+			plain := req.Header.Get(config.Header)
+			if plain == "" && config.Query != "" {
+				plain = req.URL.Query().Get(config.Query)
+			}
+
+			if plain == "" {
+				if config.Optional {
+					next(sc, w, req)
+					return
+				}
+
+				response.Problem(w, http.StatusUnauthorized, "missing api key")
+				return
+			}
+
+			key, err := config.verify(req.Context(), plain)
+			if err != nil {
+				if errors.Is(err, ErrNotFound) || errors.Is(err, ErrExpired) {
+					sc.Logger.Infof("invalid api key: %s", err)
+					response.Problem(w, http.StatusUnauthorized, "invalid api key")
+					return
+				}
+
+				sc.Logger.Errorf("failed verifying the api key: %+v", err)
+				response.Problem(w, http.StatusServiceUnavailable, "failed verifying the api key")
+				return
+			}
+
+			sc.LoggedUserIdentifier = key.Owner
+			sc.Claims = map[string]interface{}{
+				"sub":    key.Owner,
+				"scope":  strings.Join(key.Scopes, " "),
+				"key_id": key.ID,
+			}
+			sc.Logger = sc.Logger.With(logger.Fields{"user_id": key.Owner, "api_key_id": key.ID})
+
+			next(sc, w, req)
+		}
+	}
+}
+
+// verify returns the stored key matching the plain key.
+func (c Config) verify(ctx context.Context, plain string) (Key, error) {
+	id, _, ok := Split(plain)
+	if !ok {
+		return Key{}, ErrNotFound
+	}
+
+	keys, err := c.Store.Lookup(ctx, id)
+	if err != nil {
+		return Key{}, err
+	}
+
+	hash := []byte(Hash(plain))
+	now := c.now()
+
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare(hash, []byte(key.Hash)) == 1 {
+			if key.Expired(now) {
+				return Key{}, fmt.Errorf("%w: %s", ErrExpired, id)
+			}
+			return key, nil
+		}
+	}
+
+	return Key{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
@@ -0,0 +1,156 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/internal/gohantest"
+)
+
+func newTestService(t *testing.T, config Config) *gohan.Service {
+	t.Helper()
+
+	s := gohantest.NewService(t)
+
+	s.GET("/", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, sc.LoggedUserIdentifier)
+	}, New(config)).Authorize(gohan.RequireScopes("invoices:read"))
+
+	return s
+}
+
+func get(s *gohan.Service, target, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if key != "" {
+		req.Header.Set(DefaultHeader, key)
+	}
+
+	return gohantest.Serve(s, req)
+}
+
+func TestMiddleware(t *testing.T) {
+	plain, key, err := Generate("test_", "billing", "invoices:read")
+	if err != nil {
+		t.Fatalf("Generate - Expecting: nil; Got: %s", err)
+	}
+
+	if key.Hash == plain || key.Hash != Hash(plain) {
+		t.Errorf("Generate - Expecting: the key hash; Got: %s", key.Hash)
+	}
+
+	_, other, _ := Generate("test_", "reports")
+
+	s := newTestService(t, Config{Store: NewMemoryStore(key, other), Query: "api_key"})
+
+	if w := get(s, "/", plain); w.Code != http.StatusOK || w.Body.String() != "billing" {
+		t.Errorf("Header - Expecting: 200 billing; Got: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := get(s, "/?api_key="+plain, ""); w.Code != http.StatusOK {
+		t.Errorf("Query - Expecting: 200; Got: %d", w.Code)
+	}
+
+	invalid := map[string]string{
+		"missing":    "",
+		"no id":      "secret",
+		"unknown id": "test_000000000000.secret",
+		"secret":     key.ID + ".secret",
+	}
+
+	for name, plain := range invalid {
+		if w := get(s, "/", plain); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s - Expecting: 401; Got: %d", name, w.Code)
+		}
+	}
+}
+
+func TestMiddlewareScopes(t *testing.T) {
+	plain, key, _ := Generate("test_", "reports")
+	s := newTestService(t, Config{Store: NewMemoryStore(key)})
+
+	if w := get(s, "/", plain); w.Code != http.StatusForbidden {
+		t.Errorf("Missing scope - Expecting: 403; Got: %d", w.Code)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+
+	oldPlain, old, _ := Generate("test_", "billing", "invoices:read")
+	store := NewMemoryStore(old)
+
+	now := time.Now()
+	s := newTestService(t, Config{Store: store, now: func() time.Time { return now }})
+
+	newPlain, _, err := Rotate(ctx, store, old, "test_", time.Hour)
+	if err != nil {
+		t.Fatalf("Rotate - Expecting: nil; Got: %s", err)
+	}
+
+	for _, plain := range []string{oldPlain, newPlain} {
+		if w := get(s, "/", plain); w.Code != http.StatusOK {
+			t.Errorf("During the overlap - Expecting: 200; Got: %d", w.Code)
+		}
+	}
+
+	now = now.Add(2 * time.Hour)
+
+	if w := get(s, "/", oldPlain); w.Code != http.StatusUnauthorized {
+		t.Errorf("Old key after the overlap - Expecting: 401; Got: %d", w.Code)
+	}
+
+	if w := get(s, "/", newPlain); w.Code != http.StatusOK {
+		t.Errorf("New key after the overlap - Expecting: 200; Got: %d", w.Code)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+
+	write := func(keys ...Key) {
+		data, _ := json.Marshal(keys)
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("Write - Expecting: nil; Got: %s", err)
+		}
+	}
+
+	_, first, _ := Generate("test_", "billing")
+	_, second, _ := Generate("test_", "reports")
+	write(first)
+
+	store, err := NewFileStore(path, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFileStore - Expecting: nil; Got: %s", err)
+	}
+
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	if keys, err := store.Lookup(ctx, first.ID); err != nil || keys[0].Owner != "billing" {
+		t.Errorf("Lookup - Expecting: billing; Got: %v %v", keys, err)
+	}
+
+	// The file is read again after the refresh interval
+	write(first, second)
+	os.Chtimes(path, now.Add(time.Second), now.Add(time.Second))
+
+	if _, err := store.Lookup(ctx, second.ID); err != ErrNotFound {
+		t.Errorf("Lookup before the refresh - Expecting: %s; Got: %v", ErrNotFound, err)
+	}
+
+	now = now.Add(time.Minute)
+
+	if keys, err := store.Lookup(ctx, second.ID); err != nil || keys[0].Owner != "reports" {
+		t.Errorf("Lookup after the refresh - Expecting: reports; Got: %v %v", keys, err)
+	}
+}
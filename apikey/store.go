@@ -0,0 +1,275 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyStore looks up the keys by id. Implementations must be safe for concurrent use.
+type KeyStore interface {
+	// Lookup returns the keys with the given id, or ErrNotFound.
+	Lookup(ctx context.Context, id string) ([]Key, error)
+}
+
+// Manager is a store whose keys can be added and expired, see Rotate.
+type Manager interface {
+	KeyStore
+	Add(ctx context.Context, key Key) error
+	Expire(ctx context.Context, id string, at time.Time) error
+}
+
+// Rotate replaces the key with a new one for the same owner and scopes. The old key
+// keeps working during the overlap, so the clients can switch to the new one.
+func Rotate(ctx context.Context, store Manager, old Key, prefix string, overlap time.Duration) (string, Key, error) {
+	plain, key, err := Generate(prefix, old.Owner, old.Scopes...)
+	if err != nil {
+		return "", Key{}, err
+	}
+
+	if err := store.Add(ctx, key); err != nil {
+		return "", Key{}, fmt.Errorf("failed adding the new key: %w", err)
+	}
+
+	if err := store.Expire(ctx, old.ID, time.Now().Add(overlap)); err != nil {
+		return "", Key{}, fmt.Errorf("failed expiring the key %s: %w", old.ID, err)
+	}
+
+	return plain, key, nil
+}
+
+// MemoryStore keeps the keys in memory.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys map[string][]Key
+}
+
+// NewMemoryStore returns a store containing the keys.
+func NewMemoryStore(keys ...Key) *MemoryStore {
+	m := &MemoryStore{keys: make(map[string][]Key)}
+	for _, key := range keys {
+		m.keys[key.ID] = append(m.keys[key.ID], key)
+	}
+
+	return m
+}
+
+// Lookup implements the KeyStore interface.
+func (m *MemoryStore) Lookup(ctx context.Context, id string) ([]Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys, ok := m.keys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return keys, nil
+}
+
+// Add implements the Manager interface.
+func (m *MemoryStore) Add(ctx context.Context, key Key) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys[key.ID] = append(m.keys[key.ID], key)
+	return nil
+}
+
+// Expire implements the Manager interface.
+func (m *MemoryStore) Expire(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys, ok := m.keys[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	expired := make([]Key, len(keys))
+	for i, key := range keys {
+		key.ExpiresAt = at
+		expired[i] = key
+	}
+
+	m.keys[id] = expired
+	return nil
+}
+
+// DefaultFileRefreshInterval is how often the key file is checked for changes.
+const DefaultFileRefreshInterval = time.Minute
+
+// FileStore reads the keys from a JSON file containing a list of keys. The file is read
+// again when it changes, it's checked at most once per refresh interval.
+type FileStore struct {
+	path     string
+	interval time.Duration
+
+	mu        sync.Mutex
+	keys      *MemoryStore
+	modTime   time.Time
+	lastCheck time.Time
+
+	// used by the tests
+	now func() time.Time
+}
+
+// NewFileStore reads the key file. A zero interval uses DefaultFileRefreshInterval.
+func NewFileStore(path string, interval time.Duration) (*FileStore, error) {
+	if interval <= 0 {
+		interval = DefaultFileRefreshInterval
+	}
+
+	f := &FileStore{path: path, interval: interval, now: time.Now}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lastCheck = f.now()
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Lookup implements the KeyStore interface. When the file can't be read again, the
+// previous keys are kept.
+func (f *FileStore) Lookup(ctx context.Context, id string) ([]Key, error) {
+	f.mu.Lock()
+	now := f.now()
+	if now.Sub(f.lastCheck) >= f.interval {
+		f.lastCheck = now
+
+		if info, err := os.Stat(f.path); err == nil && !info.ModTime().Equal(f.modTime) {
+			if err := f.load(); err != nil {
+				f.mu.Unlock()
+				return nil, fmt.Errorf("failed reloading the key file %s: %w", f.path, err)
+			}
+		}
+	}
+	keys := f.keys
+	f.mu.Unlock()
+
+	return keys.Lookup(ctx, id)
+}
+
+// load reads the file. The lock must be held.
+func (f *FileStore) load() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("invalid key file %s: %w", f.path, err)
+	}
+
+	f.keys = NewMemoryStore(keys...)
+	f.modTime = info.ModTime()
+	return nil
+}
+
+// DefaultTable is the table used by the SQL store when none is configured.
+const DefaultTable = "api_keys"
+
+// SQLStore keeps the keys in a table of the service database, e.g. for MySQL:
+//
+//	CREATE TABLE api_keys (
+//		id         VARCHAR(64)  NOT NULL,
+//		hash       CHAR(64)     NOT NULL,
+//		owner      VARCHAR(255) NOT NULL,
+//		scopes     TEXT         NOT NULL,
+//		expires_at DATETIME     NULL,
+//		PRIMARY KEY (id, hash)
+//	);
+//
+// The scopes are stored space separated.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLStore returns a store using the table. An empty table uses DefaultTable.
+func NewSQLStore(db *sql.DB, table string) *SQLStore {
+	if table == "" {
+		table = DefaultTable
+	}
+
+	return &SQLStore{db: db, table: table}
+}
+
+// Lookup implements the KeyStore interface.
+func (s *SQLStore) Lookup(ctx context.Context, id string) ([]Key, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, hash, owner, scopes, expires_at FROM "+s.table+" WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []Key
+	for rows.Next() {
+		var key Key
+		var scopes string
+		var expiresAt sql.NullTime
+
+		if err := rows.Scan(&key.ID, &key.Hash, &key.Owner, &scopes, &expiresAt); err != nil {
+			return nil, err
+		}
+
+		key.Scopes = strings.Fields(scopes)
+		if expiresAt.Valid {
+			key.ExpiresAt = expiresAt.Time
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return keys, nil
+}
+
+// Add implements the Manager interface.
+func (s *SQLStore) Add(ctx context.Context, key Key) error {
+	var expiresAt sql.NullTime
+	if !key.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: key.ExpiresAt, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, "INSERT INTO "+s.table+" (id, hash, owner, scopes, expires_at) VALUES (?, ?, ?, ?, ?)",
+		key.ID, key.Hash, key.Owner, strings.Join(key.Scopes, " "), expiresAt)
+	return err
+}
+
+// Expire implements the Manager interface.
+func (s *SQLStore) Expire(ctx context.Context, id string, at time.Time) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE "+s.table+" SET expires_at = ? WHERE id = ?", at, id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
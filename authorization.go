@@ -0,0 +1,126 @@
+package gohan
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/appnaconda/gohan/response"
+)
+
+// PolicyFunc decides if the request is allowed.
+type PolicyFunc func(sc *ServiceContext, req *http.Request) bool
+
+// AuthRule is an authorization requirement of a route or a group. The name describes
+// the rule in the logs and the route introspection.
+type AuthRule struct {
+	Name  string
+	Allow PolicyFunc
+}
+
+// Authenticated requires an authenticated user (ServiceContext.LoggedUserIdentifier).
+func Authenticated() AuthRule {
+	return AuthRule{
+		Name: "authenticated",
+		Allow: func(sc *ServiceContext, req *http.Request) bool {
+			return sc.LoggedUserIdentifier != ""
+		},
+	}
+}
+
+// RequireScopes requires every scope, read from the scope (space separated) or scp claim.
+func RequireScopes(scopes ...string) AuthRule {
+	return AuthRule{
+		Name: "scopes:" + strings.Join(scopes, ","),
+		Allow: func(sc *ServiceContext, req *http.Request) bool {
+			granted := claimValues(sc.Claims, "scope", "scp")
+			for _, scope := range scopes {
+				if !contains(granted, scope) {
+					return false
+				}
+			}
+			return true
+		},
+	}
+}
+
+// RequireRoles requires one of the roles, read from the roles or role claim.
+func RequireRoles(roles ...string) AuthRule {
+	return AuthRule{
+		Name: "roles:" + strings.Join(roles, ","),
+		Allow: func(sc *ServiceContext, req *http.Request) bool {
+			granted := claimValues(sc.Claims, "roles", "role")
+			for _, role := range roles {
+				if contains(granted, role) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// RequirePolicy requires the policy to allow the request.
+func RequirePolicy(name string, policy PolicyFunc) AuthRule {
+	return AuthRule{Name: "policy:" + name, Allow: policy}
+}
+
+// authorize checks the rules of the route before calling the handler. Unauthenticated
+// requests get a 401 problem response and authenticated ones a 403.
+func (s *Service) authorize(route *Route, h HandlerFunc) HandlerFunc {
+	return func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		for _, rule := range route.Rules() {
+			if rule.Allow(sc, req) {
+				continue
+			}
+
+			if sc.LoggedUserIdentifier == "" {
+				sc.Logger.Infof("access denied to %s %s: authentication required by %s", route.Method, route.Pattern, rule.Name)
+				response.Problem(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+
+			sc.Logger.Warnf("access denied to %s %s for %s: %s", route.Method, route.Pattern, sc.LoggedUserIdentifier, rule.Name)
+			response.Problem(w, http.StatusForbidden, "insufficient permissions")
+			return
+		}
+
+		h(sc, w, req)
+	}
+}
+
+// claimValues returns the values of the first claim found with values, so an empty
+// scope claim falls back to scp. The claim can be a space separated string or a list
+// of strings.
+func claimValues(claims map[string]interface{}, names ...string) []string {
+	for _, name := range names {
+		var values []string
+
+		switch v := claims[name].(type) {
+		case string:
+			values = strings.Fields(v)
+		case []string:
+			values = v
+		case []interface{}:
+			for _, value := range v {
+				if s, ok := value.(string); ok {
+					values = append(values, s)
+				}
+			}
+		}
+
+		if len(values) > 0 {
+			return values
+		}
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
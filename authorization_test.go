@@ -0,0 +1,116 @@
+package gohan
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// authenticate simulates an authentication middleware.
+func authenticate(sc *ServiceContext, req *http.Request) {
+	if user := req.Header.Get("X-User"); user != "" {
+		sc.LoggedUserIdentifier = user
+		sc.Claims = map[string]interface{}{
+			"scope": req.Header.Get("X-Scope"),
+			"roles": []interface{}{req.Header.Get("X-Role")},
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	s := newTestService(t)
+	s.Use(func(next HandlerFunc) HandlerFunc {
+		return func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+			authenticate(sc, req)
+			next(sc, w, req)
+		}
+	})
+
+	handler := func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {}
+
+	s.GET("/public", handler)
+	s.GET("/orders", handler).Authorize(RequireScopes("orders:read"))
+
+	admin := s.Group("/admin")
+	admin.DELETE("/users/:id", handler).Authorize(RequirePolicy("not-self", func(sc *ServiceContext, req *http.Request) bool {
+		return sc.LoggedUserIdentifier != "root"
+	}))
+	// The group rules also apply to the routes registered before
+	admin.Authorize(RequireRoles("admin", "ops"))
+
+	tests := []struct {
+		method, path, user, scope, role string
+		code                            int
+	}{
+		{http.MethodGet, "/public", "", "", "", http.StatusOK},
+		{http.MethodGet, "/orders", "", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/orders", "john", "orders:write", "", http.StatusForbidden},
+		{http.MethodGet, "/orders", "john", "orders:write orders:read", "", http.StatusOK},
+		{http.MethodDelete, "/admin/users/1", "", "", "", http.StatusUnauthorized},
+		{http.MethodDelete, "/admin/users/1", "john", "", "user", http.StatusForbidden},
+		{http.MethodDelete, "/admin/users/1", "john", "", "ops", http.StatusOK},
+		{http.MethodDelete, "/admin/users/1", "root", "", "admin", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		req.Header.Set("X-User", test.user)
+		req.Header.Set("X-Scope", test.scope)
+		req.Header.Set("X-Role", test.role)
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != test.code {
+			t.Errorf("%s %s as %q - Expecting: %d; Got: %d", test.method, test.path, test.user, test.code, w.Code)
+		}
+	}
+}
+
+func TestRoutesAuthorization(t *testing.T) {
+	s := newTestService(t)
+	handler := func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {}
+
+	s.GET("/public", handler)
+	s.Group("/api").Authorize(Authenticated()).Group("/orders").GET("", handler).Authorize(RequireScopes("orders:read"))
+
+	w := httptest.NewRecorder()
+	s.Admin.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/routes", nil))
+
+	var routes []RouteInfo
+	json.Unmarshal(w.Body.Bytes(), &routes)
+
+	if len(routes) != 2 {
+		t.Fatalf("GET /routes - Expecting: 2 routes; Got: %v", routes)
+	}
+
+	if routes[0].Pattern != "/api/orders" || len(routes[0].Authorization) != 2 ||
+		routes[0].Authorization[0] != "authenticated" || routes[0].Authorization[1] != "scopes:orders:read" {
+		t.Errorf("Protected route - Expecting: authenticated, scopes:orders:read; Got: %+v", routes[0])
+	}
+
+	if routes[1].Pattern != "/public" || routes[1].Authorization == nil || len(routes[1].Authorization) != 0 {
+		t.Errorf("Public route - Expecting: no rules; Got: %+v", routes[1])
+	}
+}
+
+func TestClaimValues(t *testing.T) {
+	tests := []struct {
+		claims   map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"scope": "orders:read orders:write"}, "orders:read,orders:write"},
+		{map[string]interface{}{"scp": []interface{}{"orders:read", 1}}, "orders:read"},
+		{map[string]interface{}{"scope": "", "scp": []string{"orders:read"}}, "orders:read"},
+		{map[string]interface{}{"scope": " ", "scp": "orders:read"}, "orders:read"},
+		{map[string]interface{}{"scope": ""}, ""},
+	}
+
+	for _, test := range tests {
+		if values := strings.Join(claimValues(test.claims, "scope", "scp"), ","); values != test.expected {
+			t.Errorf("%v - Expecting: %q; Got: %q", test.claims, test.expected, values)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// Package breaker contains a circuit breaker, failing fast the calls to a dependency
+// that keeps failing instead of piling up requests waiting for it:
+//
+//	b := breaker.New(breaker.Config{Name: "payments", Logger: service.Logger, Metrics: service.Metrics})
+//	err := b.Execute(func() error {
+//		return charge(ctx, order)
+//	})
+//
+// The breaker is closed while the failure ratio of the calls in the window stays below
+// Config.FailureRatio. Once above, it opens and the calls fail with ErrOpen without
+// being made. After the cool-down, it's half-open: a few trial calls are let through,
+// their success closes the breaker, a failure opens it again.
+//
+// See Transport to use a breaker per host with an http client.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/appnaconda/gohan/logger"
+	"github.com/appnaconda/gohan/metrics"
+)
+
+// ErrOpen is returned by the calls rejected while the breaker is open, or half-open
+// with the trial calls in progress.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State of a breaker.
+type State int
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	return stateName[s]
+}
+
+var stateName = [...]string{
+	"closed",
+	"half-open",
+	"open",
+}
+
+// Default values of the configuration.
+const (
+	DefaultName             = "default"
+	DefaultFailureRatio     = 0.5
+	DefaultMinRequests      = 10
+	DefaultWindow           = 10 * time.Second
+	DefaultCoolDown         = 30 * time.Second
+	DefaultHalfOpenRequests = 1
+)
+
+// buckets is the number of parts of the window, the oldest one is dropped as time passes.
+const buckets = 10
+
+// Config contains the settings of a breaker.
+type Config struct {
+	// Name of the breaker in the logs and metrics. Defaults to DefaultName.
+	Name string
+
+	// Ratio of failed calls in the window opening the breaker. Defaults to DefaultFailureRatio.
+	FailureRatio float64
+
+	// Minimum number of calls in the window before the breaker can open. Defaults
+	// to DefaultMinRequests.
+	MinRequests int
+
+	// Duration of the sliding window of calls. Defaults to DefaultWindow.
+	Window time.Duration
+
+	// Time the breaker stays open before letting trial calls through. Defaults to
+	// DefaultCoolDown.
+	CoolDown time.Duration
+
+	// Number of successful trial calls closing the half-open breaker. Defaults to
+	// DefaultHalfOpenRequests.
+	HalfOpenRequests int
+
+	// Reports if the error of a call is a failure of the dependency. Defaults to any
+	// error. The calls cancelled by the caller (context.Canceled) aren't recorded.
+	IsFailure func(err error) bool
+
+	// Receives the state transitions when set.
+	Logger  logger.Logger
+	Metrics *metrics.Metrics
+}
+
+// result of a call.
+type result int
+
+const (
+	success result = iota
+	failure
+	ignored
+)
+
+type bucket struct {
+	successes int
+	failures  int
+}
+
+// Breaker is a circuit breaker. It's safe for concurrent use.
+type Breaker struct {
+	config Config
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	openedAt time.Time
+
+	// calls of the closed state
+	buckets     [buckets]bucket
+	current     int
+	bucketStart time.Time
+
+	// trial calls of the half-open state
+	trials    int
+	successes int
+
+	// incremented on each transition, the results of the calls started before are ignored
+	generation uint64
+}
+
+// New returns a closed breaker.
+func New(config Config) *Breaker {
+	if config.Name == "" {
+		config.Name = DefaultName
+	}
+
+	if config.FailureRatio <= 0 || config.FailureRatio > 1 {
+		config.FailureRatio = DefaultFailureRatio
+	}
+
+	if config.MinRequests <= 0 {
+		config.MinRequests = DefaultMinRequests
+	}
+
+	if config.Window <= 0 {
+		config.Window = DefaultWindow
+	}
+
+	if config.CoolDown <= 0 {
+		config.CoolDown = DefaultCoolDown
+	}
+
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = DefaultHalfOpenRequests
+	}
+
+	if config.IsFailure == nil {
+		config.IsFailure = isFailure
+	}
+
+	if config.Metrics != nil {
+		config.Metrics.SetBreakerState(config.Name, int(Closed))
+	}
+
+	return &Breaker{config: config, now: time.Now}
+}
+
+func isFailure(err error) bool {
+	return err != nil
+}
+
+// Execute calls fn if the breaker allows it and records its result. It returns ErrOpen
+// without calling fn when the breaker is open. A panic of fn is recorded as a failure.
+func (b *Breaker) Execute(fn func() error) error {
+	generation, err := b.allow()
+	if err != nil {
+		return err
+	}
+
+	res := failure
+	defer func() {
+		b.done(generation, res)
+	}()
+
+	err = fn()
+	res = b.result(err)
+	return err
+}
+
+// result classifies the error of a call.
+func (b *Breaker) result(err error) result {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ignored
+	case b.config.IsFailure(err):
+		return failure
+	default:
+		return success
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.config.CoolDown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// allow reserves a call, it returns the generation of the breaker to pass to done.
+func (b *Breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	switch b.state {
+	case Open:
+		if now.Sub(b.openedAt) < b.config.CoolDown {
+			return 0, ErrOpen
+		}
+		b.setState(HalfOpen, now)
+		fallthrough
+
+	case HalfOpen:
+		if b.trials >= b.config.HalfOpenRequests {
+			return 0, ErrOpen
+		}
+		b.trials++
+	}
+
+	return b.generation, nil
+}
+
+// done records the result of a call allowed by allow.
+func (b *Breaker) done(generation uint64, res result) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	if res == ignored {
+		// frees the trial slot of the half-open state
+		if b.state == HalfOpen {
+			b.trials--
+		}
+		return
+	}
+
+	now := b.now()
+
+	switch b.state {
+	case Closed:
+		b.advance(now)
+		if res == failure {
+			b.buckets[b.current].failures++
+		} else {
+			b.buckets[b.current].successes++
+		}
+
+		var successes, failures int
+		for _, bucket := range b.buckets {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+
+		total := successes + failures
+		if total >= b.config.MinRequests && float64(failures)/float64(total) >= b.config.FailureRatio {
+			b.setState(Open, now)
+		}
+
+	case HalfOpen:
+		if res == failure {
+			b.setState(Open, now)
+			return
+		}
+
+		b.successes++
+		if b.successes >= b.config.HalfOpenRequests {
+			b.setState(Closed, now)
+		}
+	}
+}
+
+// advance drops the buckets older than the window. The lock must be held.
+func (b *Breaker) advance(now time.Time) {
+	size := b.config.Window / buckets
+	if size <= 0 {
+		size = 1
+	}
+
+	steps := int(now.Sub(b.bucketStart) / size)
+	if steps <= 0 {
+		return
+	}
+
+	if steps >= buckets {
+		b.buckets = [buckets]bucket{}
+		b.bucketStart = now
+		return
+	}
+
+	for i := 0; i < steps; i++ {
+		b.current = (b.current + 1) % buckets
+		b.buckets[b.current] = bucket{}
+	}
+	b.bucketStart = b.bucketStart.Add(time.Duration(steps) * size)
+}
+
+// setState changes the state and resets the counters. The lock must be held.
+func (b *Breaker) setState(state State, now time.Time) {
+	from := b.state
+
+	b.state = state
+	b.generation++
+	b.buckets = [buckets]bucket{}
+	b.bucketStart = now
+	b.trials = 0
+	b.successes = 0
+
+	if state == Open {
+		b.openedAt = now
+	}
+
+	if b.config.Logger != nil {
+		if state == Open {
+			b.config.Logger.Warnf("circuit breaker %s: %s -> %s", b.config.Name, from, state)
+		} else {
+			b.config.Logger.Infof("circuit breaker %s: %s -> %s", b.config.Name, from, state)
+		}
+	}
+
+	if b.config.Metrics != nil {
+		b.config.Metrics.ObserveBreaker(b.config.Name, from.String(), state.String(), int(state))
+	}
+}
@@ -0,0 +1,283 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appnaconda/gohan/metrics"
+)
+
+var errDown = errors.New("down")
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestBreaker(config Config) (*Breaker, *clock) {
+	b := New(config)
+	c := &clock{now: time.Now()}
+	b.now = c.Now
+	return b, c
+}
+
+func run(b *Breaker, n int, err error) (calls int) {
+	for i := 0; i < n; i++ {
+		b.Execute(func() error {
+			calls++
+			return err
+		})
+	}
+	return calls
+}
+
+func TestOpen(t *testing.T) {
+	m := metrics.New()
+	b, _ := newTestBreaker(Config{Name: "payments", MinRequests: 4, FailureRatio: 0.5, Metrics: m})
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if e := `circuit_breaker_state{name="payments"} 0`; !strings.Contains(w.Body.String(), e) {
+		t.Errorf("New breaker - Expecting metrics to contain %s", e)
+	}
+
+	run(b, 2, nil)
+	run(b, 1, errDown)
+	if b.State() != Closed {
+		t.Fatalf("Below MinRequests - Expecting: closed; Got: %s", b.State())
+	}
+
+	run(b, 1, errDown)
+	if b.State() != Open {
+		t.Fatalf("Failure ratio - Expecting: open; Got: %s", b.State())
+	}
+
+	if calls := run(b, 5, nil); calls != 0 {
+		t.Errorf("Open - Expecting: no calls; Got: %d", calls)
+	}
+
+	if err := b.Execute(func() error { return nil }); !errors.Is(err, ErrOpen) {
+		t.Errorf("Open - Expecting: ErrOpen; Got: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	for _, e := range []string{
+		`circuit_breaker_state{name="payments"} 2`,
+		`circuit_breaker_transitions_total{from="closed",name="payments",to="open"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), e) {
+			t.Errorf("Expecting metrics to contain %s", e)
+		}
+	}
+}
+
+func TestHalfOpen(t *testing.T) {
+	b, clock := newTestBreaker(Config{MinRequests: 2, CoolDown: time.Minute, HalfOpenRequests: 2})
+
+	run(b, 2, errDown)
+	clock.Add(time.Minute)
+
+	if b.State() != HalfOpen {
+		t.Fatalf("Cool-down - Expecting: half-open; Got: %s", b.State())
+	}
+
+	// a failed trial opens the breaker again
+	run(b, 1, errDown)
+	if b.State() != Open {
+		t.Fatalf("Failed trial - Expecting: open; Got: %s", b.State())
+	}
+
+	clock.Add(time.Minute)
+
+	// only HalfOpenRequests trials at once
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go b.Execute(func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	if calls := run(b, 1, nil); calls != 1 {
+		t.Errorf("Second trial - Expecting: 1 call; Got: %d", calls)
+	}
+
+	if calls := run(b, 1, nil); calls != 0 {
+		t.Errorf("Third trial - Expecting: no call; Got: %d", calls)
+	}
+
+	close(release)
+	for i := 0; i < 100 && b.State() != Closed; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	if b.State() != Closed {
+		t.Errorf("Successful trials - Expecting: closed; Got: %s", b.State())
+	}
+}
+
+func TestWindow(t *testing.T) {
+	b, clock := newTestBreaker(Config{MinRequests: 4, Window: 10 * time.Second})
+
+	run(b, 3, errDown)
+	clock.Add(11 * time.Second)
+
+	// the old failures left the window
+	run(b, 1, errDown)
+	run(b, 3, nil)
+
+	if b.State() != Closed {
+		t.Errorf("Window - Expecting: closed; Got: %s", b.State())
+	}
+}
+
+func TestCanceled(t *testing.T) {
+	b, clock := newTestBreaker(Config{MinRequests: 2, CoolDown: time.Minute})
+
+	// the callers giving up aren't recorded, neither as failures nor as successes
+	run(b, 5, fmt.Errorf("charge: %w", context.Canceled))
+	if b.State() != Closed {
+		t.Fatalf("Canceled - Expecting: closed; Got: %s", b.State())
+	}
+
+	run(b, 1, nil)
+	run(b, 1, errDown)
+	if b.State() != Open {
+		t.Fatalf("Canceled not counted - Expecting: open; Got: %s", b.State())
+	}
+
+	// a cancelled trial frees its slot
+	clock.Add(time.Minute)
+	run(b, 1, context.Canceled)
+	if calls := run(b, 1, nil); calls != 1 {
+		t.Errorf("Trial after cancelled one - Expecting: 1 call; Got: %d", calls)
+	}
+
+	if b.State() != Closed {
+		t.Errorf("Successful trial - Expecting: closed; Got: %s", b.State())
+	}
+}
+
+func TestPanic(t *testing.T) {
+	b, clock := newTestBreaker(Config{MinRequests: 1, CoolDown: time.Minute})
+
+	run(b, 1, errDown)
+	clock.Add(time.Minute)
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("Panic - Expecting: boom; Got: %v", p)
+			}
+		}()
+
+		b.Execute(func() error {
+			panic("boom")
+		})
+	}()
+
+	// the panicking trial is a failure, it doesn't keep the trial slot
+	if b.State() != Open {
+		t.Fatalf("Panicking trial - Expecting: open; Got: %s", b.State())
+	}
+
+	clock.Add(time.Minute)
+	if calls := run(b, 1, nil); calls != 1 {
+		t.Errorf("Next trial - Expecting: 1 call; Got: %d", calls)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer up.Close()
+
+	transport := NewTransport(nil, Config{MinRequests: 3})
+	c := &http.Client{Transport: transport}
+
+	for i := 0; i < 3; i++ {
+		if res, err := c.Get(down.URL); err == nil {
+			res.Body.Close()
+		}
+	}
+
+	if _, err := c.Get(down.URL); !errors.Is(err, ErrOpen) {
+		t.Errorf("Failing host - Expecting: ErrOpen; Got: %v", err)
+	}
+
+	res, err := c.Get(up.URL)
+	if err != nil {
+		t.Fatalf("Other host - Expecting: nil; Got: %s", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Other host - Expecting: 200; Got: %d", res.StatusCode)
+	}
+
+	if state := transport.Breaker(strings.TrimPrefix(up.URL, "http://")).State(); state != Closed {
+		t.Errorf("Other host - Expecting: closed; Got: %s", state)
+	}
+}
+
+func TestTransportMaxHosts(t *testing.T) {
+	m := metrics.New()
+	transport := NewTransport(nil, Config{Name: "api", Metrics: m})
+	transport.MaxHosts = 2
+
+	a := transport.Breaker("a")
+	transport.Breaker("b")
+
+	// a is the most recently used, b is dropped
+	transport.Breaker("a")
+	transport.Breaker("c")
+
+	if len(transport.breakers) != 2 {
+		t.Errorf("Hosts - Expecting: 2; Got: %d", len(transport.breakers))
+	}
+
+	if transport.Breaker("a") != a {
+		t.Errorf("Recently used host - Expecting: same breaker")
+	}
+
+	if _, ok := transport.breakers["b"]; ok {
+		t.Errorf("Least recently used host - Expecting: dropped")
+	}
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if e := `circuit_breaker_state{name="api/b"}`; strings.Contains(w.Body.String(), e) {
+		t.Errorf("Least recently used host - Expecting metrics not to contain %s", e)
+	}
+
+	if e := `circuit_breaker_state{name="api/a"} 0`; !strings.Contains(w.Body.String(), e) {
+		t.Errorf("Recently used host - Expecting metrics to contain %s", e)
+	}
+}
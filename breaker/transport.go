@@ -0,0 +1,117 @@
+package breaker
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Transport is an http.RoundTripper using a breaker per host, so a failing dependency
+// doesn't affect the calls to the other ones. The requests rejected by an open breaker
+// fail with an error wrapping ErrOpen:
+//
+//	service.HttpClient = client.New(client.Config{
+//		Transport: breaker.NewTransport(nil, breaker.Config{Logger: service.Logger, Metrics: service.Metrics}),
+//	})
+//
+// Failed requests and 5xx responses are failures. Config.Name prefixes the host in the
+// logs and metrics. The breakers of the least recently called hosts are dropped, with
+// their metrics, beyond MaxHosts hosts.
+type Transport struct {
+	// Maximum number of hosts with a breaker, defaults to DefaultMaxHosts. It must be
+	// set before the first request.
+	MaxHosts int
+
+	base   http.RoundTripper
+	config Config
+
+	mu       sync.Mutex
+	hosts    *list.List
+	breakers map[string]*list.Element
+}
+
+// DefaultMaxHosts is the default maximum number of hosts with a breaker of a Transport.
+const DefaultMaxHosts = 1000
+
+// hostBreaker is an element of the hosts list, the most recently called first.
+type hostBreaker struct {
+	host    string
+	breaker *Breaker
+}
+
+// NewTransport returns a transport sending the requests with base, http.DefaultTransport
+// when nil.
+func NewTransport(base http.RoundTripper, config Config) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{
+		MaxHosts: DefaultMaxHosts,
+		base:     base,
+		config:   config,
+		hosts:    list.New(),
+		breakers: make(map[string]*list.Element),
+	}
+}
+
+// Breaker returns the breaker of the host.
+func (t *Transport) Breaker(host string) *Breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e, ok := t.breakers[host]; ok {
+		t.hosts.MoveToFront(e)
+		return e.Value.(*hostBreaker).breaker
+	}
+
+	config := t.config
+	config.Name = host
+	if t.config.Name != "" {
+		config.Name = t.config.Name + "/" + host
+	}
+
+	b := New(config)
+	t.breakers[host] = t.hosts.PushFront(&hostBreaker{host: host, breaker: b})
+
+	max := t.MaxHosts
+	if max <= 0 {
+		max = DefaultMaxHosts
+	}
+
+	for t.hosts.Len() > max {
+		oldest := t.hosts.Remove(t.hosts.Back()).(*hostBreaker)
+		delete(t.breakers, oldest.host)
+
+		if t.config.Metrics != nil {
+			t.config.Metrics.DeleteBreaker(oldest.breaker.config.Name)
+		}
+	}
+
+	return b
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.Breaker(req.URL.Host)
+
+	generation, err := b.allow()
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("%w: %s", err, req.URL.Host)
+	}
+
+	outcome := failure
+	defer func() {
+		b.done(generation, outcome)
+	}()
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil || res.StatusCode < http.StatusInternalServerError {
+		outcome = b.result(err)
+	}
+	return res, err
+}
@@ -0,0 +1,426 @@
+// Package cache contains a middleware caching the responses of the read endpoints in
+// memory, for the endpoints that are expensive and can serve data a few seconds old:
+//
+//	c := cache.New(cache.Config{TTL: 5 * time.Second, Metrics: service.Metrics})
+//	service.GET("/reports", reports, c.Middleware())
+//	service.GET("/stats", stats, c.TTL(time.Minute))
+//
+// The responses are keyed by method, path, query and the request headers of Config.Vary.
+// The handlers can change the freshness with the Cache-Control header (max-age, s-maxage,
+// stale-while-revalidate) or prevent the caching with no-store, no-cache or private.
+// Concurrent misses of the same key wait for a single call to the handler.
+//
+// A cache should be used by routes, not by the whole service, since its key doesn't
+// include the user: requests with an Authorization or a Cookie header aren't cached
+// unless the header is one of the Vary headers. The responses setting cookies aren't
+// stored.
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/internal/record"
+	"github.com/appnaconda/gohan/logger"
+	"github.com/appnaconda/gohan/metrics"
+)
+
+// Results of the cache lookups, sent in the X-Cache header, logged and recorded in
+// the metrics.
+const (
+	Hit    = "hit"
+	Miss   = "miss"
+	Stale  = "stale"
+	Bypass = "bypass"
+)
+
+// Default values of the configuration.
+const (
+	DefaultName          = "default"
+	DefaultTTL           = 5 * time.Second
+	DefaultMaxBytes      = 64 << 20
+	DefaultMaxEntryBytes = 1 << 20
+)
+
+// cacheableStatus are the status codes of the responses stored.
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// Config contains the settings of the cache.
+type Config struct {
+	// Name of the cache in the metrics. Defaults to DefaultName.
+	Name string
+
+	// Freshness of the responses without max-age. Defaults to DefaultTTL.
+	TTL time.Duration
+
+	// Time during which an expired response is still served while it's refreshed in
+	// the background. The responses can override it with stale-while-revalidate.
+	StaleWhileRevalidate time.Duration
+
+	// Request headers added to the key, e.g. Accept or Accept-Language.
+	Vary []string
+
+	// Maximum size of the cache, the least recently used responses are evicted.
+	// Defaults to DefaultMaxBytes.
+	MaxBytes int
+
+	// Responses larger than MaxEntryBytes aren't stored. Defaults to DefaultMaxEntryBytes.
+	MaxEntryBytes int
+
+	// Records the hits and misses when set, e.g. to service.Metrics.
+	Metrics *metrics.Metrics
+}
+
+// Cache is a size bounded LRU cache of responses, shared by the routes using its
+// middlewares.
+type Cache struct {
+	config Config
+	vary   map[string]bool
+	now    func() time.Time
+
+	mu    sync.Mutex
+	lru   *lru
+	calls map[string]*call
+}
+
+// call is a handler call in flight, filling a missing or stale entry.
+type call struct {
+	done  chan struct{}
+	entry *entry
+}
+
+// New returns a cache.
+func New(config Config) *Cache {
+	if config.Name == "" {
+		config.Name = DefaultName
+	}
+
+	if config.TTL <= 0 {
+		config.TTL = DefaultTTL
+	}
+
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DefaultMaxBytes
+	}
+
+	if config.MaxEntryBytes <= 0 {
+		config.MaxEntryBytes = DefaultMaxEntryBytes
+	}
+
+	names := make([]string, 0, len(config.Vary))
+	vary := make(map[string]bool)
+	for _, name := range config.Vary {
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		names = append(names, name)
+		vary[name] = true
+	}
+	sort.Strings(names)
+	config.Vary = names
+
+	return &Cache{
+		config: config,
+		vary:   vary,
+		now:    time.Now,
+		lru:    newLRU(config.MaxBytes),
+		calls:  make(map[string]*call),
+	}
+}
+
+// Middleware returns the caching middleware using Config.TTL.
+func (c *Cache) Middleware() gohan.MiddlewareFunc {
+	return c.TTL(c.config.TTL)
+}
+
+// TTL returns the caching middleware for a route, with its own freshness.
+func (c *Cache) TTL(ttl time.Duration) gohan.MiddlewareFunc {
+	if ttl <= 0 {
+		ttl = c.config.TTL
+	}
+
+	return func(next gohan.HandlerFunc) gohan.HandlerFunc {
+		return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+			if !c.cacheable(req) {
+				c.observe(sc, Bypass, req.URL.Path)
+				next(sc, w, req)
+				return
+			}
+
+			key := c.key(req)
+			now := c.now()
+
+			c.mu.Lock()
+			e := c.lru.get(key)
+
+			if e != nil && now.Before(e.expires) {
+				c.mu.Unlock()
+				c.observe(sc, Hit, key)
+				e.write(w, req, Hit, now)
+				return
+			}
+
+			if e != nil && now.Before(e.staleUntil) {
+				cl, refreshing := c.calls[key]
+				if !refreshing {
+					cl = &call{done: make(chan struct{})}
+					c.calls[key] = cl
+				}
+				c.mu.Unlock()
+
+				c.observe(sc, Stale, key)
+				e.write(w, req, Stale, now)
+
+				if !refreshing {
+					// The refresh outlives the request
+					go c.refresh(sc.Clone(context.WithoutCancel(sc.Context)), req.WithContext(context.WithoutCancel(req.Context())), key, ttl, next, cl)
+				}
+				return
+			}
+
+			if cl, ok := c.calls[key]; ok {
+				c.mu.Unlock()
+
+				select {
+				case <-cl.done:
+				case <-req.Context().Done():
+					return
+				}
+
+				if cl.entry != nil {
+					c.observe(sc, Hit, key)
+					cl.entry.write(w, req, Hit, c.now())
+					return
+				}
+
+				// the response wasn't cacheable
+				c.observe(sc, Miss, key)
+				next(sc, w, req)
+				return
+			}
+
+			cl := &call{done: make(chan struct{})}
+			c.calls[key] = cl
+			c.mu.Unlock()
+
+			c.observe(sc, Miss, key)
+			w.Header().Set("X-Cache", Miss)
+
+			rw := record.NewWriter(w, c.config.MaxEntryBytes)
+			completed := false
+			defer func() {
+				var e *entry
+				if completed {
+					e = c.entry(key, rw, ttl)
+				}
+				c.finish(key, cl, e)
+			}()
+
+			next(sc, rw, req)
+			rw.Close()
+			completed = true
+		}
+	}
+}
+
+// Len returns the number of cached responses.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.len()
+}
+
+// Purge removes all the cached responses.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru = newLRU(c.config.MaxBytes)
+}
+
+// cacheable reports if the request can be served from the cache.
+func (c *Cache) cacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	if _, ok := parseCacheControl(req.Header.Get("Cache-Control"))["no-store"]; ok {
+		return false
+	}
+
+	for _, name := range []string{"Authorization", "Cookie"} {
+		if req.Header.Get(name) != "" && !c.vary[name] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// key returns the key of the request: method, path, sorted query and Vary headers.
+func (c *Cache) key(req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(req.Method)
+	b.WriteByte(' ')
+	b.WriteString(req.URL.Path)
+
+	if query := req.URL.Query(); len(query) > 0 {
+		b.WriteByte('?')
+		b.WriteString(query.Encode())
+	}
+
+	for _, name := range c.config.Vary {
+		b.WriteByte('\n')
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+
+	return b.String()
+}
+
+// refresh calls the handler in the background to replace a stale entry.
+func (c *Cache) refresh(sc *gohan.ServiceContext, req *http.Request, key string, ttl time.Duration, next gohan.HandlerFunc, cl *call) {
+	var e *entry
+	defer func() {
+		if r := recover(); r != nil {
+			sc.Logger.Errorf("failed refreshing the cached response of %s: %v", req.URL.Path, r)
+		}
+		c.finish(key, cl, e)
+	}()
+
+	rw := record.NewWriter(&discardWriter{header: make(http.Header)}, c.config.MaxEntryBytes)
+	next(sc, rw, req)
+	rw.Close()
+	e = c.entry(key, rw, ttl)
+}
+
+// finish stores the entry, if any, and releases the requests waiting for the call.
+func (c *Cache) finish(key string, cl *call, e *entry) {
+	c.mu.Lock()
+	if e != nil {
+		c.lru.add(e)
+	}
+	delete(c.calls, key)
+	c.mu.Unlock()
+
+	cl.entry = e
+	close(cl.done)
+}
+
+// entry returns the entry of the recorded response, or nil if it can't be stored.
+func (c *Cache) entry(key string, rw *record.Writer, ttl time.Duration) *entry {
+	if rw.Streamed() || rw.TooLarge() || !cacheableStatus[rw.Status()] || rw.Header().Get("Set-Cookie") != "" {
+		return nil
+	}
+
+	for _, v := range rw.Header().Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+			if name != "" && !c.vary[name] {
+				return nil
+			}
+		}
+	}
+
+	directives := parseCacheControl(rw.Header().Get("Cache-Control"))
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[directive]; ok {
+			return nil
+		}
+	}
+
+	if seconds, ok := directives["s-maxage"]; ok {
+		ttl = parseSeconds(seconds)
+	} else if seconds, ok := directives["max-age"]; ok {
+		ttl = parseSeconds(seconds)
+	}
+
+	stale := c.config.StaleWhileRevalidate
+	if seconds, ok := directives["stale-while-revalidate"]; ok {
+		stale = parseSeconds(seconds)
+	}
+
+	if ttl <= 0 && stale <= 0 {
+		return nil
+	}
+
+	now := c.now()
+	header := rw.Header().Clone()
+	header.Del("X-Cache")
+
+	return &entry{
+		key:        key,
+		status:     rw.Status(),
+		header:     header,
+		body:       rw.Body(),
+		stored:     now,
+		expires:    now.Add(ttl),
+		staleUntil: now.Add(ttl + stale),
+	}
+}
+
+// observe records the result of the lookup in the metrics and the request logger.
+func (c *Cache) observe(sc *gohan.ServiceContext, result, key string) {
+	if c.config.Metrics != nil {
+		c.config.Metrics.ObserveCache(c.config.Name, result)
+	}
+
+	sc.Logger = sc.Logger.With(logger.Fields{"cache": result})
+	sc.Logger.Debugf("cache %s: %q", result, key)
+}
+
+// parseCacheControl returns the directives of a Cache-Control header, with their value.
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, value, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return directives
+}
+
+func parseSeconds(s string) time.Duration {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.Itoa(int(d / time.Second))
+}
+
+// discardWriter is the writer of the background refreshes.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) WriteHeader(int) {}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
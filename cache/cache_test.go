@@ -0,0 +1,279 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/internal/gohantest"
+	"github.com/appnaconda/gohan/metrics"
+)
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// counter returns a handler writing the number of calls, with the given Cache-Control.
+func counter(calls *int32, cacheControl string) gohan.HandlerFunc {
+	return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "call %d", n)
+	}
+}
+
+func TestHitAndMiss(t *testing.T) {
+	s := gohantest.NewService(t)
+	m := metrics.New()
+	c := New(Config{Name: "reports", Vary: []string{"accept-language"}, Metrics: m})
+
+	var calls int32
+	s.GET("/reports", counter(&calls, ""), c.Middleware())
+
+	tests := []struct {
+		path     string
+		headers  map[string]string
+		expected string
+		result   string
+	}{
+		{"/reports?a=1&b=2", nil, "call 1", Miss},
+		{"/reports?b=2&a=1", nil, "call 1", Hit},
+		{"/reports?a=1", nil, "call 2", Miss},
+		{"/reports?a=1&b=2", map[string]string{"Accept-Language": "fr"}, "call 3", Miss},
+		{"/reports?a=1&b=2", map[string]string{"Authorization": "Bearer token"}, "call 4", ""},
+		{"/reports?a=1&b=2", map[string]string{"Cache-Control": "no-store"}, "call 5", ""},
+		{"/reports?a=1", nil, "call 2", Hit},
+	}
+
+	for _, test := range tests {
+		w := gohantest.Get(s, test.path, test.headers)
+
+		if w.Body.String() != test.expected {
+			t.Errorf("%s %v - Expecting: %s; Got: %s", test.path, test.headers, test.expected, w.Body.String())
+		}
+
+		if result := w.Header().Get("X-Cache"); result != test.result {
+			t.Errorf("%s %v - Expecting: X-Cache %q; Got: %q", test.path, test.headers, test.result, result)
+		}
+
+		if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+			t.Errorf("%s %v - Expecting: Content-Type text/plain; Got: %s", test.path, test.headers, ct)
+		}
+	}
+
+	w := gohantest.Get(m.Handler(), "/metrics", nil)
+
+	for _, e := range []string{
+		`http_cache_requests_total{cache="reports",result="hit"} 2`,
+		`http_cache_requests_total{cache="reports",result="miss"} 3`,
+		`http_cache_requests_total{cache="reports",result="bypass"} 2`,
+	} {
+		if !strings.Contains(w.Body.String(), e) {
+			t.Errorf("Expecting metrics to contain %s", e)
+		}
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	s := gohantest.NewService(t)
+	c := New(Config{})
+
+	now := &clock{now: time.Now()}
+	c.now = now.Now
+
+	var private, maxAge, cookie int32
+	s.GET("/private", counter(&private, "private, max-age=60"), c.Middleware())
+	s.GET("/max-age", counter(&maxAge, "max-age=60"), c.TTL(time.Second))
+	s.GET("/cookie", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&cookie, 1)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+	}, c.Middleware())
+
+	for i := 0; i < 2; i++ {
+		gohantest.Get(s, "/private", nil)
+		gohantest.Get(s, "/max-age", nil)
+
+		// the handler only sets a header
+		if w := gohantest.Get(s, "/cookie", nil); w.Header().Get("Set-Cookie") == "" {
+			t.Errorf("Set-Cookie - Expecting: sent; Got: %v", w.Header())
+		}
+		now.Add(10 * time.Second)
+	}
+
+	if private != 2 || cookie != 2 {
+		t.Errorf("Not cacheable - Expecting: 2 calls; Got: %d private, %d cookie", private, cookie)
+	}
+
+	if maxAge != 1 {
+		t.Errorf("max-age - Expecting: 1 call; Got: %d", maxAge)
+	}
+
+	if w := gohantest.Get(s, "/max-age", nil); w.Header().Get("Age") != "20" {
+		t.Errorf("Age - Expecting: 20; Got: %s", w.Header().Get("Age"))
+	}
+}
+
+func TestCookie(t *testing.T) {
+	s := gohantest.NewService(t)
+	c := New(Config{})
+	perUser := New(Config{Vary: []string{"Cookie"}})
+
+	var shared, user, setCookie int32
+	s.GET("/shared", counter(&shared, ""), c.Middleware())
+	s.GET("/user", counter(&user, ""), perUser.Middleware())
+	s.GET("/login", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&setCookie, 1)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.Write([]byte("welcome"))
+	}, c.Middleware())
+
+	session := map[string]string{"Cookie": "session=alice"}
+	for i := 0; i < 2; i++ {
+		// a response of the user isn't served to the others
+		gohantest.Get(s, "/shared", session)
+		gohantest.Get(s, "/user", session)
+		gohantest.Get(s, "/login", nil)
+	}
+
+	if shared != 2 {
+		t.Errorf("Cookie not in Vary - Expecting: 2 calls; Got: %d", shared)
+	}
+
+	if user != 1 {
+		t.Errorf("Cookie in Vary - Expecting: 1 call; Got: %d", user)
+	}
+
+	if w := gohantest.Get(s, "/user", map[string]string{"Cookie": "session=bob"}); w.Body.String() != "call 2" {
+		t.Errorf("Other cookie - Expecting: call 2; Got: %s", w.Body.String())
+	}
+
+	if setCookie != 2 || c.Len() != 0 {
+		t.Errorf("Set-Cookie - Expecting: 2 calls and nothing stored; Got: %d calls, %d stored", setCookie, c.Len())
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	s := gohantest.NewService(t)
+	c := New(Config{TTL: time.Second, StaleWhileRevalidate: time.Minute})
+
+	now := &clock{now: time.Now()}
+	c.now = now.Now
+
+	var calls int32
+	s.GET("/reports", counter(&calls, ""), c.Middleware())
+
+	gohantest.Get(s, "/reports", nil)
+	now.Add(2 * time.Second)
+
+	w := gohantest.Get(s, "/reports", nil)
+	if w.Body.String() != "call 1" || w.Header().Get("X-Cache") != Stale {
+		t.Errorf("Stale - Expecting: call 1 stale; Got: %s %s", w.Body.String(), w.Header().Get("X-Cache"))
+	}
+
+	// wait for the background refresh
+	deadline := time.Now().Add(time.Second)
+	for {
+		if w = gohantest.Get(s, "/reports", nil); w.Body.String() == "call 2" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if w.Body.String() != "call 2" || w.Header().Get("X-Cache") != Hit {
+		t.Errorf("Refreshed - Expecting: call 2 hit; Got: %s %s", w.Body.String(), w.Header().Get("X-Cache"))
+	}
+
+	now.Add(2 * time.Minute)
+	if w = gohantest.Get(s, "/reports", nil); w.Body.String() != "call 3" || w.Header().Get("X-Cache") != Miss {
+		t.Errorf("Expired - Expecting: call 3 miss; Got: %s %s", w.Body.String(), w.Header().Get("X-Cache"))
+	}
+}
+
+func TestCoalescing(t *testing.T) {
+	s := gohantest.NewService(t)
+	c := New(Config{})
+
+	var calls int32
+	release := make(chan struct{})
+	s.GET("/slow", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Write([]byte("done"))
+	}, c.Middleware())
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i] = gohantest.Get(s, "/slow", nil).Body.String()
+		}(i)
+	}
+
+	// let the requests reach the cache before releasing the handler
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Calls - Expecting: 1; Got: %d", calls)
+	}
+
+	for i, body := range bodies {
+		if body != "done" {
+			t.Errorf("Request %d - Expecting: done; Got: %q", i, body)
+		}
+	}
+}
+
+func TestEviction(t *testing.T) {
+	s := gohantest.NewService(t)
+	c := New(Config{MaxBytes: 200})
+
+	s.GET("/items/:id", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 50)))
+	}, c.Middleware())
+
+	for i := 0; i < 10; i++ {
+		gohantest.Get(s, fmt.Sprintf("/items/%d", i), nil)
+	}
+
+	if n := c.Len(); n == 0 || n > 3 {
+		t.Errorf("Len - Expecting: 1 to 3 entries; Got: %d", n)
+	}
+
+	if w := gohantest.Get(s, "/items/9", nil); w.Header().Get("X-Cache") != Hit {
+		t.Errorf("Most recent - Expecting: hit; Got: %s", w.Header().Get("X-Cache"))
+	}
+
+	if w := gohantest.Get(s, "/items/0", nil); w.Header().Get("X-Cache") != Miss {
+		t.Errorf("Least recent - Expecting: miss; Got: %s", w.Header().Get("X-Cache"))
+	}
+
+	c.Purge()
+	if n := c.Len(); n != 0 {
+		t.Errorf("Purge - Expecting: 0 entries; Got: %d", n)
+	}
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"time"
+)
+
+// entry is a cached response.
+type entry struct {
+	key    string
+	status int
+	header http.Header
+	body   []byte
+
+	stored     time.Time
+	expires    time.Time
+	staleUntil time.Time
+}
+
+// size returns the approximate memory used by the entry.
+func (e *entry) size() int {
+	n := len(e.key) + len(e.body)
+	for name, values := range e.header {
+		n += len(name)
+		for _, v := range values {
+			n += len(v)
+		}
+	}
+	return n
+}
+
+// write replays the response, with its Age and the cache result.
+func (e *entry) write(w http.ResponseWriter, req *http.Request, result string, now time.Time) {
+	h := w.Header()
+	for name, values := range e.header {
+		h[name] = append([]string(nil), values...)
+	}
+
+	h.Set("Age", formatSeconds(now.Sub(e.stored)))
+	h.Set("X-Cache", result)
+	w.WriteHeader(e.status)
+
+	if req.Method != http.MethodHead {
+		w.Write(e.body)
+	}
+}
+
+// lru holds the entries up to maxBytes, evicting the least recently used ones.
+// It's not safe for concurrent use.
+type lru struct {
+	maxBytes int
+	size     int
+	list     *list.List
+	items    map[string]*list.Element
+}
+
+func newLRU(maxBytes int) *lru {
+	return &lru{
+		maxBytes: maxBytes,
+		list:     list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the entry and marks it as recently used, or nil.
+func (l *lru) get(key string) *entry {
+	el, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+
+	l.list.MoveToFront(el)
+	return el.Value.(*entry)
+}
+
+// add stores the entry, replacing the one with the same key. Entries larger than the
+// cache are ignored.
+func (l *lru) add(e *entry) {
+	if el, ok := l.items[e.key]; ok {
+		l.remove(el)
+	}
+
+	size := e.size()
+	if size > l.maxBytes {
+		return
+	}
+
+	l.items[e.key] = l.list.PushFront(e)
+	l.size += size
+
+	for l.size > l.maxBytes {
+		l.remove(l.list.Back())
+	}
+}
+
+func (l *lru) remove(el *list.Element) {
+	e := l.list.Remove(el).(*entry)
+	delete(l.items, e.key)
+	l.size -= e.size()
+}
+
+func (l *lru) len() int {
+	return l.list.Len()
+}
@@ -0,0 +1,253 @@
+// Package client contains an http client retrying the failed idempotent requests with
+// an exponential backoff:
+//
+//	service, err := gohan.New(ctx, option.WithHTTPClient(client.Config{MaxRetries: 3}))
+//
+// The handlers use it through ServiceContext.HttpClient, which also sends the request
+// and trace ids and logs the calls with the request logger.
+//
+// The requests are retried on network errors and on the 429, 502, 503 and 504
+// responses, if their method is idempotent (GET, HEAD, OPTIONS, TRACE, PUT, DELETE)
+// or they have an Idempotency-Key header. The Retry-After header of the responses is
+// honored. The requests rejected by an open circuit breaker (see breaker.Transport)
+// aren't retried.
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/breaker"
+)
+
+// Default values of the configuration.
+const (
+	DefaultTimeout    = 30 * time.Second
+	DefaultMaxRetries = 2
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+)
+
+// DefaultRetryStatus are the status codes retried when none are configured.
+var DefaultRetryStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// Config contains the settings of the client.
+type Config struct {
+	// Maximum duration of a call, retries included. Defaults to DefaultTimeout, a
+	// negative timeout disables it.
+	Timeout time.Duration
+
+	// Maximum time waiting for the response headers of an attempt. Only used when
+	// Transport is nil.
+	ResponseHeaderTimeout time.Duration
+
+	// Number of retries after the first attempt. Defaults to DefaultMaxRetries, a
+	// negative value disables the retries.
+	MaxRetries int
+
+	// The backoff doubles after each attempt, from MinBackoff up to MaxBackoff, with
+	// a random jitter. Responses asking to retry after more than MaxBackoff are returned
+	// as is. Default to DefaultMinBackoff and DefaultMaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Status codes of the responses retried. Defaults to DefaultRetryStatus.
+	RetryStatus []int
+
+	// Transport sending the requests, e.g. a circuit breaker. Defaults to a copy of
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// New returns a client retrying the failed idempotent requests.
+func New(config Config) *http.Client {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	} else if timeout < 0 {
+		timeout = 0
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: NewTransport(config),
+	}
+}
+
+// Transport is the http.RoundTripper retrying the requests.
+type Transport struct {
+	config Config
+	retry  map[int]bool
+
+	// used by the tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewTransport returns the retrying transport of the client, see New.
+func NewTransport(config Config) *Transport {
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	} else if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = DefaultMinBackoff
+	}
+
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultMaxBackoff
+	}
+
+	if len(config.RetryStatus) == 0 {
+		config.RetryStatus = DefaultRetryStatus
+	}
+
+	if config.Transport == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if config.ResponseHeaderTimeout > 0 {
+			transport.ResponseHeaderTimeout = config.ResponseHeaderTimeout
+		}
+		config.Transport = transport
+	}
+
+	retry := make(map[int]bool)
+	for _, code := range config.RetryStatus {
+		retry[code] = true
+	}
+
+	return &Transport{config: config, retry: retry, sleep: sleep}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retryable := Idempotent(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		res, err := t.config.Transport.RoundTrip(req)
+		if !retryable || attempt >= t.config.MaxRetries || !t.shouldRetry(req, res, err) {
+			return res, err
+		}
+
+		wait := t.backoff(attempt)
+		if res != nil {
+			if after, ok := retryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+				if after > t.config.MaxBackoff {
+					return res, nil
+				}
+				if after > wait {
+					wait = after
+				}
+			}
+
+			// the connection is reused once the body is read
+			io.CopyN(ioutil.Discard, res.Body, 4<<10)
+			res.Body.Close()
+		}
+
+		if sc, ok := gohan.FromContext(req.Context()); ok {
+			sc.Logger.Debugf("http client: retrying %s %s in %s (attempt %d): %s", req.Method, req.URL.Host+req.URL.Path, wait, attempt+1, reason(res, err))
+		}
+
+		if err := t.sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// shouldRetry reports if the attempt failed with a transient error.
+func (t *Transport) shouldRetry(req *http.Request, res *http.Response, err error) bool {
+	if err != nil {
+		// the caller gave up or the dependency is known to be down
+		return req.Context().Err() == nil && !errors.Is(err, context.Canceled) && !errors.Is(err, breaker.ErrOpen)
+	}
+
+	return t.retry[res.StatusCode]
+}
+
+// backoff returns the wait before the retry, between half and the whole exponential
+// backoff so the clients don't retry at the same time.
+func (t *Transport) backoff(attempt int) time.Duration {
+	d := t.config.MinBackoff << uint(attempt)
+	if d <= 0 || d > t.config.MaxBackoff {
+		d = t.config.MaxBackoff
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Idempotent reports if the request can be sent several times: its method is
+// idempotent or it has an Idempotency-Key header.
+func Idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// retryAfter parses the Retry-After header, in seconds or as a date.
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+
+	if d := date.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+func reason(res *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return res.Status
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
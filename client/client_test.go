@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a server answering with the given status codes, then 200.
+func newTestServer(t *testing.T, codes ...int) (*httptest.Server, *int32) {
+	t.Helper()
+
+	attempts := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := int(atomic.AddInt32(attempts, 1))
+		body, _ := ioutil.ReadAll(req.Body)
+
+		if n <= len(codes) {
+			if codes[n-1] == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "2")
+			}
+			w.WriteHeader(codes[n-1])
+			return
+		}
+
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, attempts
+}
+
+// newTestClient returns a client recording its waits instead of sleeping.
+func newTestClient(config Config, waits *[]time.Duration) *http.Client {
+	transport := NewTransport(config)
+	transport.sleep = func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return nil
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+func TestRetry(t *testing.T) {
+	server, attempts := newTestServer(t, http.StatusServiceUnavailable, http.StatusBadGateway)
+
+	var waits []time.Duration
+	c := newTestClient(Config{MinBackoff: 100 * time.Millisecond}, &waits)
+
+	req, _ := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("payload"))
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Do - Expecting: nil; Got: %s", err)
+	}
+	defer res.Body.Close()
+
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(body) != "payload" {
+		t.Errorf("Response - Expecting: 200 payload; Got: %d %s", res.StatusCode, body)
+	}
+
+	if *attempts != 3 || len(waits) != 2 {
+		t.Fatalf("Attempts - Expecting: 3 attempts, 2 waits; Got: %d %v", *attempts, waits)
+	}
+
+	if waits[0] < 50*time.Millisecond || waits[0] > 100*time.Millisecond || waits[1] < 100*time.Millisecond || waits[1] > 200*time.Millisecond {
+		t.Errorf("Backoff - Expecting: 50-100ms then 100-200ms; Got: %v", waits)
+	}
+}
+
+func TestMaxRetries(t *testing.T) {
+	server, attempts := newTestServer(t, 503, 503, 503, 503)
+
+	var waits []time.Duration
+	c := newTestClient(Config{MaxRetries: 2}, &waits)
+
+	res, err := c.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get - Expecting: nil; Got: %s", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusServiceUnavailable || *attempts != 3 {
+		t.Errorf("Expecting: 503 after 3 attempts; Got: %d after %d", res.StatusCode, *attempts)
+	}
+}
+
+func TestNotIdempotent(t *testing.T) {
+	server, attempts := newTestServer(t, 503, 503)
+
+	var waits []time.Duration
+	c := newTestClient(Config{}, &waits)
+
+	res, err := c.Post(server.URL, "text/plain", strings.NewReader("order"))
+	if err != nil {
+		t.Fatalf("Post - Expecting: nil; Got: %s", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusServiceUnavailable || *attempts != 1 {
+		t.Errorf("POST - Expecting: 503 after 1 attempt; Got: %d after %d", res.StatusCode, *attempts)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("order"))
+	req.Header.Set("Idempotency-Key", "key-1")
+
+	res, err = c.Do(req)
+	if err != nil {
+		t.Fatalf("Idempotency-Key - Expecting: nil; Got: %s", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || *attempts != 3 {
+		t.Errorf("Idempotency-Key - Expecting: 200 after 3 attempts; Got: %d after %d", res.StatusCode, *attempts)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	server, _ := newTestServer(t, http.StatusTooManyRequests)
+
+	var waits []time.Duration
+	c := newTestClient(Config{MaxBackoff: 5 * time.Second}, &waits)
+
+	res, err := c.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get - Expecting: nil; Got: %s", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || len(waits) != 1 || waits[0] != 2*time.Second {
+		t.Errorf("Retry-After - Expecting: 200 after waiting 2s; Got: %d %v", res.StatusCode, waits)
+	}
+
+	// the server asks to wait longer than the client accepts
+	server, attempts := newTestServer(t, http.StatusTooManyRequests)
+	waits = nil
+	c = newTestClient(Config{MaxBackoff: time.Second}, &waits)
+
+	res, err = c.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get - Expecting: nil; Got: %s", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusTooManyRequests || *attempts != 1 {
+		t.Errorf("Long Retry-After - Expecting: 429 after 1 attempt; Got: %d after %d", res.StatusCode, *attempts)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := map[string]time.Duration{
+		"3": 3 * time.Second,
+		now.Add(10 * time.Second).Format(http.TimeFormat): 10 * time.Second,
+		now.Add(-time.Minute).Format(http.TimeFormat):     0,
+	}
+
+	for header, expected := range tests {
+		if d, ok := retryAfter(header, now); !ok || d != expected {
+			t.Errorf("%q - Expecting: %s; Got: %s %t", header, expected, d, ok)
+		}
+	}
+
+	for _, header := range []string{"", "-1", "soon"} {
+		if _, ok := retryAfter(header, now); ok {
+			t.Errorf("%q - Expecting: invalid", header)
+		}
+	}
+}
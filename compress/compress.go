@@ -0,0 +1,414 @@
+// Package compress contains a middleware compressing the responses with brotli, gzip
+// or deflate, depending on the Accept-Encoding header of the request:
+//
+//	service.Use(compress.New(compress.Config{}))
+//
+// Small responses and content types that are already compressed (images, archives, ...)
+// are sent as is. Flush sends the data compressed so far, so the streaming responses
+// keep working. The HEAD responses get the headers of the GET ones.
+//
+// The strong ETags of the compressed responses get the encoding as suffix, e.g.
+// "abc-gzip", so the compressed representation has its own tag. The suffix is removed
+// from the If-Match and If-None-Match headers of the requests, so the inner middlewares
+// and handlers compare them with the tags they generated.
+package compress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/appnaconda/gohan"
+)
+
+// Supported encodings.
+const (
+	Brotli  = "br"
+	Gzip    = "gzip"
+	Deflate = "deflate"
+)
+
+// Default values of the configuration.
+const (
+	DefaultMinSize = 1024
+
+	// brotli is slow on its highest levels, this one is close to gzip in speed.
+	DefaultBrotliLevel = 4
+)
+
+// DefaultEncodings are the encodings used, by order of preference, when none are configured.
+var DefaultEncodings = []string{Brotli, Gzip, Deflate}
+
+// DefaultContentTypes are the content types compressed when none are configured.
+var DefaultContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"application/x-ndjson",
+	"image/svg+xml",
+}
+
+// Config contains the settings of the middleware.
+type Config struct {
+	// Encodings by order of preference, used when the client accepts several of them
+	// with the same quality. Defaults to DefaultEncodings.
+	Encodings []string
+
+	// Responses smaller than MinSize bytes are not compressed. Defaults to DefaultMinSize.
+	MinSize int
+
+	// Prefixes of the content types to compress. Defaults to DefaultContentTypes.
+	ContentTypes []string
+}
+
+// encoder is implemented by the gzip, flate and brotli writers.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// New returns the compression middleware.
+func New(config Config) gohan.MiddlewareFunc {
+	if len(config.Encodings) == 0 {
+		config.Encodings = DefaultEncodings
+	}
+
+	if config.MinSize <= 0 {
+		config.MinSize = DefaultMinSize
+	}
+
+	if len(config.ContentTypes) == 0 {
+		config.ContentTypes = DefaultContentTypes
+	}
+
+	// The writers allocate large buffers, they are reused between the requests.
+	pools := map[string]*sync.Pool{
+		Brotli: {New: func() interface{} {
+			return brotli.NewWriterLevel(nil, DefaultBrotliLevel)
+		}},
+		Gzip: {New: func() interface{} {
+			return gzip.NewWriter(nil)
+		}},
+		Deflate: {New: func() interface{} {
+			w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+			return w
+		}},
+	}
+
+	return func(next gohan.HandlerFunc) gohan.HandlerFunc {
+		return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+			inm := decodeETags(req.Header, "If-None-Match", config.Encodings)
+			decodeETags(req.Header, "If-Match", config.Encodings)
+
+			// The upgraded connections need the original writer
+			if req.Header.Get("Upgrade") != "" {
+				next(sc, w, req)
+				return
+			}
+
+			encoding := negotiate(req.Header.Get("Accept-Encoding"), config.Encodings)
+			if encoding == "" {
+				addVary(w.Header())
+				next(sc, w, req)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				config:         &config,
+				encoding:       encoding,
+				pool:           pools[encoding],
+				head:           req.Method == http.MethodHead,
+				encodedETag:    inm[encoding],
+			}
+			defer cw.close()
+
+			next(sc, cw, req)
+		}
+	}
+}
+
+// negotiate returns the supported encoding with the highest quality in the
+// Accept-Encoding header, or an empty string.
+func negotiate(header string, supported []string) string {
+	if header == "" {
+		return ""
+	}
+
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range supported {
+		q, ok := qualities[encoding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+// encodeETag returns the strong etag of the representation compressed with the encoding,
+// the weak etags are returned as is.
+func encodeETag(etag, encoding string) string {
+	if strings.HasPrefix(etag, "W/") || len(etag) < 2 || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+
+	return etag[:len(etag)-1] + "-" + encoding + `"`
+}
+
+// decodeETags removes the encoding suffixes of the etags of the conditional header. It
+// returns the encodings found.
+func decodeETags(h http.Header, name string, encodings []string) map[string]bool {
+	list := h.Get(name)
+	if list == "" {
+		return nil
+	}
+
+	found := make(map[string]bool)
+	tags := strings.Split(list, ",")
+	for i, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		for _, encoding := range encodings {
+			if suffix := "-" + encoding + `"`; strings.HasSuffix(tag, suffix) {
+				tag = tag[:len(tag)-len(suffix)] + `"`
+				found[encoding] = true
+				break
+			}
+		}
+		tags[i] = tag
+	}
+
+	if len(found) > 0 {
+		h.Set(name, strings.Join(tags, ", "))
+	}
+
+	return found
+}
+
+func addVary(h http.Header) {
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(name), "Accept-Encoding") {
+				return
+			}
+		}
+	}
+
+	h.Add("Vary", "Accept-Encoding")
+}
+
+// compressWriter buffers the beginning of the response until it knows if it should
+// be compressed: MinSize bytes were written, the handler flushed or returned.
+type compressWriter struct {
+	http.ResponseWriter
+
+	config   *Config
+	encoding string
+	pool     *sync.Pool
+
+	// the body of the HEAD responses is discarded
+	head bool
+
+	// the client sent the etag of the compressed representation, used by the 304 responses
+	encodedETag bool
+
+	code        int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	enc         encoder
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+
+	// informational responses are sent as is
+	if code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.code = code
+	w.wroteHeader = true
+
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.decided {
+		if w.head {
+			return len(b), nil
+		}
+		if w.enc != nil {
+			return w.enc.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.config.MinSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Flush sends the data written so far, compressing it if the response is compressible.
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !w.decided {
+		w.decide(true)
+	}
+
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original writer, see http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide writes the headers and the buffered data, compressed if allowed and the
+// response is large enough.
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+
+	h := w.ResponseWriter.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	compressed := false
+	if large && w.compressible(h) {
+		compressed = true
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+
+		if !w.head {
+			w.enc = w.pool.Get().(encoder)
+			w.enc.Reset(w.ResponseWriter)
+		}
+	}
+
+	if etag := h.Get("ETag"); etag != "" && (compressed || (w.code == http.StatusNotModified && w.encodedETag)) {
+		h.Set("ETag", encodeETag(etag, w.encoding))
+	}
+
+	if h.Get("Content-Encoding") == "" || compressed {
+		addVary(h)
+	}
+
+	w.ResponseWriter.WriteHeader(w.code)
+
+	if len(w.buf) == 0 || w.head {
+		w.buf = nil
+		return nil
+	}
+
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+
+	return err
+}
+
+func (w *compressWriter) compressible(h http.Header) bool {
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	if length, err := strconv.Atoi(h.Get("Content-Length")); err == nil && length < w.config.MinSize {
+		return false
+	}
+
+	contentType := strings.ToLower(h.Get("Content-Type"))
+	for _, allowed := range w.config.ContentTypes {
+		if strings.HasPrefix(contentType, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// close writes the end of the response once the handler returns.
+func (w *compressWriter) close() {
+	if !w.decided {
+		if !w.wroteHeader && !w.head {
+			// nothing was written
+			addVary(w.ResponseWriter.Header())
+			return
+		}
+
+		if !w.wroteHeader {
+			w.WriteHeader(http.StatusOK)
+		}
+
+		// the HEAD responses are as large as announced
+		length, err := strconv.Atoi(w.ResponseWriter.Header().Get("Content-Length"))
+		w.decide(w.head && err == nil && length >= w.config.MinSize)
+	}
+
+	if w.enc != nil {
+		w.enc.Close()
+		w.enc.Reset(nil)
+		w.pool.Put(w.enc)
+		w.enc = nil
+	}
+}
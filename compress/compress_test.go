@@ -0,0 +1,272 @@
+package compress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/etag"
+	"github.com/appnaconda/gohan/internal/gohantest"
+	"github.com/appnaconda/gohan/response"
+)
+
+var large = strings.Repeat(`{"name":"gohan"}`, 200)
+
+func newTestService(t *testing.T) *gohan.Service {
+	t.Helper()
+
+	s := gohantest.NewService(t)
+	s.Use(New(Config{}))
+
+	write := func(contentType, body string) gohan.HandlerFunc {
+		return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Write([]byte(body))
+		}
+	}
+
+	s.GET("/large", write("application/json", large))
+	s.HEAD("/large", write("application/json", large))
+	s.GET("/small", write("application/json", `{"name":"gohan"}`))
+	s.GET("/image", write("image/png", large))
+	s.GET("/sniffed", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("<html>" + large))
+	})
+	s.GET("/encoded", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte(large))
+	})
+
+	return s
+}
+
+func get(s *gohan.Service, path, acceptEncoding string) *httptest.ResponseRecorder {
+	return gohantest.Get(s, path, map[string]string{"Accept-Encoding": acceptEncoding})
+}
+
+func decode(t *testing.T, encoding string, r io.Reader) string {
+	t.Helper()
+
+	switch encoding {
+	case Gzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatalf("gzip - Expecting: nil; Got: %s", err)
+		}
+		r = gr
+	case Deflate:
+		r = flate.NewReader(r)
+	case Brotli:
+		r = brotli.NewReader(r)
+	}
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s - Expecting: nil; Got: %s", encoding, err)
+	}
+
+	return string(body)
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := map[string]string{
+		"":                              "",
+		"identity":                      "",
+		"gzip":                          Gzip,
+		"gzip, deflate, br":             Brotli,
+		"GZIP;q=1.0, br;q=0.5":          Gzip,
+		"br;q=0, deflate":               Deflate,
+		"*":                             Brotli,
+		"*;q=0.1, gzip;q=0.5":           Gzip,
+		"gzip;q=0, *":                   Brotli,
+		"br;q=0, gzip;q=0, deflate;q=0": "",
+	}
+
+	for header, expected := range tests {
+		if encoding := negotiate(header, DefaultEncodings); encoding != expected {
+			t.Errorf("%q - Expecting: %q; Got: %q", header, expected, encoding)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	s := newTestService(t)
+
+	for _, encoding := range []string{Brotli, Gzip, Deflate} {
+		w := get(s, "/large", encoding)
+
+		if ce := w.Header().Get("Content-Encoding"); ce != encoding {
+			t.Errorf("%s - Expecting: Content-Encoding %s; Got: %s", encoding, encoding, ce)
+		}
+
+		if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("%s - Expecting: Vary Accept-Encoding; Got: %s", encoding, vary)
+		}
+
+		if w.Body.Len() >= len(large) {
+			t.Errorf("%s - Expecting: compressed body; Got: %d bytes", encoding, w.Body.Len())
+		}
+
+		if body := decode(t, encoding, w.Body); body != large {
+			t.Errorf("%s - Expecting: the original body; Got: %d bytes", encoding, len(body))
+		}
+	}
+}
+
+func TestNoCompression(t *testing.T) {
+	s := newTestService(t)
+
+	tests := map[string]string{
+		"/small":   "gzip",
+		"/image":   "gzip",
+		"/large":   "",
+		"/encoded": "br",
+	}
+
+	for path, acceptEncoding := range tests {
+		w := get(s, path, acceptEncoding)
+
+		if ce := w.Header().Get("Content-Encoding"); ce != "" && path != "/encoded" {
+			t.Errorf("%s - Expecting: no Content-Encoding; Got: %s", path, ce)
+		}
+
+		if path == "/encoded" && w.Body.String() != large {
+			t.Errorf("%s - Expecting: the body as is; Got: %d bytes", path, w.Body.Len())
+		}
+	}
+
+	if w := get(s, "/large", ""); w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Uncompressed - Expecting: Vary Accept-Encoding; Got: %s", w.Header().Get("Vary"))
+	}
+}
+
+func TestSniffedContentType(t *testing.T) {
+	s := newTestService(t)
+	w := get(s, "/sniffed", "gzip")
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type - Expecting: text/html; Got: %s", ct)
+	}
+
+	if ce := w.Header().Get("Content-Encoding"); ce != Gzip {
+		t.Errorf("Content-Encoding - Expecting: gzip; Got: %s", ce)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	s := newTestService(t)
+
+	release := make(chan struct{})
+	s.GET("/stream", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+
+		<-release
+		w.Write([]byte("data: second\n\n"))
+	})
+
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /stream - Expecting: nil; Got: %s", err)
+	}
+	defer res.Body.Close()
+
+	if ce := res.Header.Get("Content-Encoding"); ce != Gzip {
+		t.Fatalf("Content-Encoding - Expecting: gzip; Got: %s", ce)
+	}
+
+	// The first event is readable before the end of the response
+	gr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatalf("gzip - Expecting: nil; Got: %s", err)
+	}
+
+	first := make([]byte, len("data: first\n\n"))
+	if _, err := io.ReadFull(gr, first); err != nil || string(first) != "data: first\n\n" {
+		t.Fatalf("First event - Expecting: data: first; Got: %q %v", first, err)
+	}
+
+	close(release)
+
+	if body := decode(t, "", gr); body != "data: second\n\n" {
+		t.Errorf("Second event - Expecting: data: second; Got: %q", body)
+	}
+}
+
+func TestETag(t *testing.T) {
+	s := gohantest.NewService(t)
+
+	current := response.ETag([]byte(large))
+	s.Use(etag.New(etag.Config{
+		Current: func(sc *gohan.ServiceContext, req *http.Request) (string, time.Time, error) {
+			return current, time.Time{}, nil
+		},
+	}), New(Config{}))
+
+	handler := func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(large))
+	}
+	s.GET("/large", handler)
+	s.PUT("/large", handler)
+
+	identity := get(s, "/large", "")
+	if tag := identity.Header().Get("ETag"); tag != current {
+		t.Fatalf("Identity - Expecting: %s; Got: %s", current, tag)
+	}
+
+	compressed := get(s, "/large", Gzip)
+	tag := compressed.Header().Get("ETag")
+	if expected := strings.TrimSuffix(current, `"`) + `-gzip"`; tag != expected {
+		t.Errorf("Compressed - Expecting: %s; Got: %s", expected, tag)
+	}
+
+	send := func(method, header string) *httptest.ResponseRecorder {
+		req := gohantest.NewRequest(method, "/large", strings.NewReader(large), map[string]string{"Accept-Encoding": Gzip, header: tag})
+		return gohantest.Serve(s, req)
+	}
+
+	// the tag of the compressed representation validates the cached copy
+	if w := send(http.MethodGet, "If-None-Match"); w.Code != http.StatusNotModified || w.Header().Get("ETag") != tag {
+		t.Errorf("If-None-Match - Expecting: 304 %s; Got: %d %s", tag, w.Code, w.Header().Get("ETag"))
+	}
+
+	// and passes the strong comparison of If-Match
+	if w := send(http.MethodPut, "If-Match"); w.Code != http.StatusOK {
+		t.Errorf("If-Match - Expecting: 200; Got: %d", w.Code)
+	}
+
+	current = `"modified"`
+	if w := send(http.MethodPut, "If-Match"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("If-Match modified - Expecting: 412; Got: %d", w.Code)
+	}
+}
+
+func TestHead(t *testing.T) {
+	s := newTestService(t)
+
+	w := gohantest.Do(s, http.MethodHead, "/large", map[string]string{"Accept-Encoding": Gzip})
+
+	if w.Header().Get("Content-Encoding") != Gzip || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("HEAD - Expecting: the headers of GET; Got: %v", w.Header())
+	}
+
+	if w.Body.Len() != 0 {
+		t.Errorf("HEAD - Expecting: no body; Got: %d bytes", w.Body.Len())
+	}
+}
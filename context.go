@@ -1,8 +1,10 @@
 package gohan
 
 import (
+	"crypto/x509"
 	"database/sql"
 	"fmt"
+	"sync"
 
 	"context"
 
@@ -12,11 +14,82 @@ import (
 )
 
 type ServiceContext struct {
-	Logger               logger.Logger
-	Context              context.Context
-	HttpClient           *http.Client
+	Logger logger.Logger
+
+	// Context of the request, cancelled when the client goes away or the route times
+	// out. It carries the values of the service context.
+	Context context.Context
+
 	db                   *sql.DB
 	LoggedUserIdentifier string
+
+	// Client of the service sending the request and trace ids and logging the calls
+	// with the request logger, see option.WithHTTPClient.
+	HttpClient *http.Client
+
+	// Ids of the request and of its trace, sent to the services called with HttpClient.
+	RequestID string
+	TraceID   string
+
+	// Claims of the token used to authenticate the request, see the jwtauth package.
+	Claims map[string]interface{}
+
+	// Verified client certificate when the service uses mutual TLS.
+	ClientCertificate        *x509.Certificate
+	ClientCertificateSubject string
+
+	// Values set by the middlewares, see Set and Get.
+	valuesMu sync.RWMutex
+	values   map[string]interface{}
+}
+
+// Set stores a value for the duration of the request, e.g. the session of the request.
+// The packages should use prefixed keys to avoid collisions.
+func (sc *ServiceContext) Set(key string, value interface{}) {
+	sc.valuesMu.Lock()
+	defer sc.valuesMu.Unlock()
+
+	if sc.values == nil {
+		sc.values = make(map[string]interface{})
+	}
+	sc.values[key] = value
+}
+
+// Get returns the value stored with Set, or nil.
+func (sc *ServiceContext) Get(key string) interface{} {
+	sc.valuesMu.RLock()
+	defer sc.valuesMu.RUnlock()
+
+	return sc.values[key]
+}
+
+// Clone returns a copy of the service context using ctx, for the work outliving the
+// request, e.g. a background refresh. The values are copied.
+func (sc *ServiceContext) Clone(ctx context.Context) *ServiceContext {
+	sc.valuesMu.RLock()
+	defer sc.valuesMu.RUnlock()
+
+	clone := &ServiceContext{
+		Logger:                   sc.Logger,
+		Context:                  ctx,
+		HttpClient:               sc.HttpClient,
+		RequestID:                sc.RequestID,
+		TraceID:                  sc.TraceID,
+		db:                       sc.db,
+		LoggedUserIdentifier:     sc.LoggedUserIdentifier,
+		Claims:                   sc.Claims,
+		ClientCertificate:        sc.ClientCertificate,
+		ClientCertificateSubject: sc.ClientCertificateSubject,
+	}
+
+	if sc.values != nil {
+		clone.values = make(map[string]interface{}, len(sc.values))
+		for key, value := range sc.values {
+			clone.values[key] = value
+		}
+	}
+
+	return clone
 }
 
 func (sc *ServiceContext) GetDB() (*sql.DB, error) {
@@ -0,0 +1,150 @@
+package gohan
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/cors"
+)
+
+// CORSPolicy describes the cross-origin requests accepted by the service.
+// A nil policy means that no CORS headers are sent at all.
+type CORSPolicy struct {
+	// Origins a cross-domain request can be executed from. "*" allows any origin and
+	// a single wildcard can be used for subdomains (e.g. https://*.example.com).
+	AllowedOrigins []string
+
+	// Custom function to validate the origin. When set, AllowedOrigins is ignored.
+	AllowOriginFunc func(origin string) bool
+
+	// Methods the client is allowed to use. Defaults to GET, POST and HEAD.
+	AllowedMethods []string
+
+	// Non simple headers the client is allowed to use. "*" allows any header.
+	AllowedHeaders []string
+
+	// Headers which are safe to expose to the client.
+	ExposedHeaders []string
+
+	// Whether the request can include user credentials like cookies or TLS client certificates.
+	AllowCredentials bool
+
+	// How long (in seconds) the results of a preflight request can be cached.
+	MaxAge int
+}
+
+// AllowAllCORSPolicy returns a permissive policy allowing any origin, the common
+// methods and any header. Credentials are not allowed.
+func AllowAllCORSPolicy() *CORSPolicy {
+	return &CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{
+			http.MethodHead,
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		},
+		AllowedHeaders: []string{"*"},
+	}
+}
+
+// corsOverride is a policy applied to every path under the given prefix.
+// A nil policy disables CORS for that prefix.
+type corsOverride struct {
+	prefix string
+	policy *CORSPolicy
+}
+
+// corsOverrideList holds the CORS policies of the groups. Like the middlewares, they
+// are fixed once the service handler is built.
+type corsOverrideList struct {
+	mu     sync.Mutex
+	list   []corsOverride
+	sealed bool
+}
+
+// add appends the override, it panics once the list is sealed.
+func (l *corsOverrideList) add(o corsOverride) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.sealed {
+		panic("gohan - Group.CORS called after the service started serving")
+	}
+
+	l.list = append(l.list, o)
+}
+
+// seal prevents adding overrides and returns them.
+func (l *corsOverrideList) seal() []corsOverride {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sealed = true
+	return l.list
+}
+
+func newCORSHandler(policy *CORSPolicy, h http.Handler) http.Handler {
+	if policy == nil {
+		return h
+	}
+
+	return cors.New(cors.Options{
+		AllowedOrigins:   policy.AllowedOrigins,
+		AllowOriginFunc:  policy.AllowOriginFunc,
+		AllowedMethods:   policy.AllowedMethods,
+		AllowedHeaders:   policy.AllowedHeaders,
+		ExposedHeaders:   policy.ExposedHeaders,
+		AllowCredentials: policy.AllowCredentials,
+		MaxAge:           policy.MaxAge,
+	}).Handler(h)
+}
+
+// corsHandler wraps the handler with the service CORS policy and the group overrides.
+// The override with the longest matching prefix wins.
+func (s *Service) corsHandler(h http.Handler) http.Handler {
+	defaultHandler := newCORSHandler(s.CORS, h)
+
+	overrides := s.corsOverrides.seal()
+	if len(overrides) == 0 {
+		return defaultHandler
+	}
+
+	type prefixHandler struct {
+		prefix  string
+		handler http.Handler
+	}
+
+	handlers := make([]prefixHandler, 0, len(overrides))
+	for _, o := range overrides {
+		handlers = append(handlers, prefixHandler{prefix: o.prefix, handler: newCORSHandler(o.policy, h)})
+	}
+
+	sort.SliceStable(handlers, func(i, j int) bool {
+		return len(handlers[i].prefix) > len(handlers[j].prefix)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for _, ph := range handlers {
+			if hasPathPrefix(req.URL.Path, ph.prefix) {
+				ph.handler.ServeHTTP(w, req)
+				return
+			}
+		}
+
+		defaultHandler.ServeHTTP(w, req)
+	})
+}
+
+// hasPathPrefix checks if the path is equal to the prefix or is one of its sub paths.
+func hasPathPrefix(path, prefix string) bool {
+	if prefix == "" || prefix == "/" {
+		return true
+	}
+
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,76 @@
+package gohan
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSPolicy(t *testing.T) {
+	s := &Service{
+		CORS: &CORSPolicy{
+			AllowedOrigins: []string{"https://*.example.com"},
+		},
+	}
+
+	public := s.Group("/public")
+	public.CORS(AllowAllCORSPolicy())
+
+	internal := s.Group("/internal")
+	internal.CORS(nil)
+
+	h := s.corsHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	tt := []struct {
+		path   string
+		origin string
+		expect string
+	}{
+		{path: "/users", origin: "https://app.example.com", expect: "https://app.example.com"},
+		{path: "/users", origin: "https://evil.com", expect: ""},
+		{path: "/public/users", origin: "https://evil.com", expect: "*"},
+		{path: "/publicity", origin: "https://evil.com", expect: ""},
+		{path: "/internal/users", origin: "https://app.example.com", expect: ""},
+	}
+
+	for _, tc := range tt {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("Origin", tc.origin)
+		w := httptest.NewRecorder()
+
+		h.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tc.expect {
+			t.Errorf("%s from %s - Expecting: %q; Got: %q", tc.path, tc.origin, tc.expect, got)
+		}
+	}
+}
+
+func TestCORSAfterServing(t *testing.T) {
+	s := newTestService(t)
+	s.Group("/public").CORS(AllowAllCORSPolicy())
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("CORS after serving - Expecting: panic")
+		}
+	}()
+
+	s.Group("/internal").CORS(nil)
+}
+
+func TestCORSDisabledByDefault(t *testing.T) {
+	s := &Service{}
+	h := s.corsHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expecting: no CORS headers; Got: %q", got)
+	}
+}
@@ -0,0 +1,357 @@
+// Package csrf contains a middleware protecting the form submissions against
+// cross-site request forgery.
+//
+// The token of the request is available with Token, or TemplateField for the forms:
+//
+//	<form method="POST" action="/settings">
+//		{{ .CSRFField }}
+//		...
+//	</form>
+//
+// with CSRFField set to csrf.TemplateField(sc). The unsafe requests (POST, PUT, ...)
+// must send the token in the X-CSRF-Token header or the csrf_token form field, and
+// come from the same origin (Origin and Referer headers).
+//
+// By default the token is kept in a cookie (double submit), signed when Config.Secret
+// is set. With UseSession, it is kept in the session (synchronizer token) and the
+// session middleware must wrap the csrf one.
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/response"
+	"github.com/appnaconda/gohan/session"
+)
+
+// Default values of the configuration.
+const (
+	DefaultCookieName = "csrf_token"
+	DefaultHeader     = "X-CSRF-Token"
+	DefaultField      = "csrf_token"
+)
+
+const (
+	tokenLength = 32
+
+	// keys of the token in the ServiceContext and the session
+	contextKey = "gohan.csrf"
+	sessionKey = "csrf_token"
+)
+
+// Config contains the settings of the middleware.
+type Config struct {
+	// Keeps the token in the session instead of a cookie.
+	UseSession bool
+
+	// Signs the cookie of the double submit with HMAC-SHA256, so the cookies set by
+	// another subdomain are rejected. Without secret, the cookie must be host-only:
+	// a name with the __Host- prefix, Secure and no Domain.
+	Secret []byte
+
+	// Cookie settings. The cookie isn't HttpOnly so the scripts can send the token
+	// in the header. SameSite defaults to Lax.
+	CookieName string
+	Path       string
+	Domain     string
+	Secure     bool
+	SameSite   http.SameSite
+
+	// Header and form field containing the token. Default to DefaultHeader and DefaultField.
+	Header string
+	Field  string
+
+	// Hosts (e.g. app.example.com) allowed to send requests besides the service one.
+	TrustedOrigins []string
+
+	// Skips the requests with a bearer token. Browsers don't add the Authorization
+	// header on their own, so these requests can't be forged.
+	ExemptBearer bool
+
+	// Skips the requests for which it returns true.
+	Exempt func(req *http.Request) bool
+}
+
+// New returns a middleware rejecting the unsafe requests without a valid token or
+// from another origin with a 403 problem response.
+func New(config Config) gohan.MiddlewareFunc {
+	if config.CookieName == "" {
+		config.CookieName = DefaultCookieName
+	}
+
+	if config.Path == "" {
+		config.Path = "/"
+	}
+
+	if config.SameSite == 0 {
+		config.SameSite = http.SameSiteLaxMode
+	}
+
+	if config.Header == "" {
+		config.Header = DefaultHeader
+	}
+
+	if config.Field == "" {
+		config.Field = DefaultField
+	}
+
+	return func(next gohan.HandlerFunc) gohan.HandlerFunc {
+		return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+			if config.exempt(req) {
+				next(sc, w, req)
+				return
+			}
+
+			token, err := config.token(sc, w, req)
+			if err != nil {
+				sc.Logger.Errorf("failed generating the csrf token: %+v", err)
+				response.Problem(w, http.StatusInternalServerError, "failed generating the csrf token")
+				return
+			}
+
+			sc.Set(contextKey, &state{token: token, field: config.Field})
+
+			if !safeMethod(req.Method) {
+				if err := config.verify(req, token); err != nil {
+					sc.Logger.Warnf("csrf check failed: %s", err)
+					response.Problem(w, http.StatusForbidden, "csrf check failed")
+					return
+				}
+			}
+
+			next(sc, w, req)
+		}
+	}
+}
+
+// Token returns the token to send with the unsafe requests. It is different on every
+// call so it can't be guessed from compressed responses (BREACH).
+func Token(sc *gohan.ServiceContext) string {
+	st, ok := sc.Get(contextKey).(*state)
+	if !ok {
+		return ""
+	}
+
+	return mask(st.token)
+}
+
+// TemplateField returns a hidden input containing the token, for the html templates.
+func TemplateField(sc *gohan.ServiceContext) template.HTML {
+	st, ok := sc.Get(contextKey).(*state)
+	if !ok {
+		return ""
+	}
+
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+		template.HTMLEscapeString(st.field), mask(st.token)))
+}
+
+// state is the csrf state of a request.
+type state struct {
+	token []byte
+	field string
+}
+
+func (c Config) exempt(req *http.Request) bool {
+	if c.Exempt != nil && c.Exempt(req) {
+		return true
+	}
+
+	auth := req.Header.Get("Authorization")
+	return c.ExemptBearer && len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ")
+}
+
+// token returns the token of the client, creating it when missing.
+func (c Config) token(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) ([]byte, error) {
+	if c.UseSession {
+		sess := session.FromContext(sc)
+		if sess == nil {
+			return nil, fmt.Errorf("no session, the session middleware must wrap the csrf one")
+		}
+
+		if encoded, ok := sess.Get(sessionKey).(string); ok {
+			if token, err := base64.RawURLEncoding.DecodeString(encoded); err == nil && len(token) == tokenLength {
+				return token, nil
+			}
+		}
+
+		token, err := gohan.GenerateRandomBytes(tokenLength)
+		if err != nil {
+			return nil, err
+		}
+
+		sess.Set(sessionKey, base64.RawURLEncoding.EncodeToString(token))
+		return token, nil
+	}
+
+	if cookie, err := req.Cookie(c.CookieName); err == nil {
+		if token, ok := c.decodeCookie(cookie.Value); ok {
+			return token, nil
+		}
+	}
+
+	token, err := gohan.GenerateRandomBytes(tokenLength)
+	if err != nil {
+		return nil, err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.CookieName,
+		Value:    c.encodeCookie(token),
+		Path:     c.Path,
+		Domain:   c.Domain,
+		Secure:   c.Secure,
+		SameSite: c.SameSite,
+	})
+
+	return token, nil
+}
+
+// encodeCookie returns the cookie value of the token, followed by its signature when
+// there is a secret.
+func (c Config) encodeCookie(token []byte) string {
+	value := base64.RawURLEncoding.EncodeToString(token)
+	if len(c.Secret) == 0 {
+		return value
+	}
+
+	return value + "." + base64.RawURLEncoding.EncodeToString(c.sign(token))
+}
+
+// decodeCookie returns the token of the cookie value, checking its signature when
+// there is a secret.
+func (c Config) decodeCookie(value string) ([]byte, bool) {
+	var signature []byte
+	if len(c.Secret) > 0 {
+		i := strings.IndexByte(value, '.')
+		if i < 0 {
+			return nil, false
+		}
+
+		var err error
+		if signature, err = base64.RawURLEncoding.DecodeString(value[i+1:]); err != nil {
+			return nil, false
+		}
+		value = value[:i]
+	}
+
+	token, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(token) != tokenLength {
+		return nil, false
+	}
+
+	if len(c.Secret) > 0 && !hmac.Equal(signature, c.sign(token)) {
+		return nil, false
+	}
+
+	return token, true
+}
+
+func (c Config) sign(token []byte) []byte {
+	mac := hmac.New(sha256.New, c.Secret)
+	mac.Write(token)
+	return mac.Sum(nil)
+}
+
+// verify checks the origin of the request and the token it contains.
+func (c Config) verify(req *http.Request, token []byte) error {
+	if origin := req.Header.Get("Origin"); origin != "" {
+		if !c.trusted(req, origin) {
+			return fmt.Errorf("untrusted origin %s", origin)
+		}
+	} else if referer := req.Referer(); referer != "" {
+		if !c.trusted(req, referer) {
+			return fmt.Errorf("untrusted referer %s", referer)
+		}
+	} else if req.TLS != nil {
+		// Over https, the browsers always send one of them
+		return fmt.Errorf("missing origin and referer")
+	}
+
+	sent := req.Header.Get(c.Header)
+	if sent == "" {
+		sent = req.PostFormValue(c.Field)
+	}
+
+	if sent == "" {
+		return fmt.Errorf("missing token")
+	}
+
+	if !equal(sent, token) {
+		return fmt.Errorf("invalid token")
+	}
+
+	return nil
+}
+
+// trusted reports if the url is from the service host or a trusted origin.
+func (c Config) trusted(req *http.Request, rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, req.Host) {
+		return true
+	}
+
+	for _, origin := range c.TrustedOrigins {
+		if strings.EqualFold(u.Host, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// mask returns the token xored with a random pad, followed by the pad.
+func mask(token []byte) string {
+	pad, err := gohan.GenerateRandomBytes(len(token))
+	if err != nil {
+		// the token is still valid unmasked
+		return base64.RawURLEncoding.EncodeToString(token)
+	}
+
+	masked := make([]byte, 0, 2*len(token))
+	for i := range token {
+		masked = append(masked, token[i]^pad[i])
+	}
+
+	return base64.RawURLEncoding.EncodeToString(append(masked, pad...))
+}
+
+// equal compares the sent token, masked or not, with the token of the client.
+func equal(sent string, token []byte) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(sent)
+	if err != nil {
+		return false
+	}
+
+	if len(decoded) == 2*len(token) {
+		unmasked := make([]byte, len(token))
+		for i := range token {
+			unmasked[i] = decoded[i] ^ decoded[len(token)+i]
+		}
+		decoded = unmasked
+	}
+
+	return subtle.ConstantTimeCompare(decoded, token) == 1
+}
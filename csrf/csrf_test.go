@@ -0,0 +1,162 @@
+package csrf
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/internal/gohantest"
+	"github.com/appnaconda/gohan/session"
+)
+
+func newTestService(t *testing.T, config Config, middlewares ...gohan.MiddlewareFunc) *gohan.Service {
+	t.Helper()
+
+	s := gohantest.NewService(t)
+
+	g := s.Group("", append([]gohan.MiddlewareFunc{New(config)}, middlewares...)...)
+	g.GET("/form", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(TemplateField(sc)))
+	})
+	g.POST("/form", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {})
+
+	return s
+}
+
+var fieldValue = regexp.MustCompile(`value="([^"]+)"`)
+
+// form returns the cookies and the token of the form page.
+func form(t *testing.T, s *gohan.Service) ([]*http.Cookie, string) {
+	t.Helper()
+
+	w := gohantest.Get(s, "http://example.com/form", nil)
+
+	match := fieldValue.FindStringSubmatch(w.Body.String())
+	if match == nil {
+		t.Fatalf("Template field - Expecting: hidden input; Got: %s", w.Body.String())
+	}
+
+	return w.Result().Cookies(), match[1]
+}
+
+func post(s *gohan.Service, cookies []*http.Cookie, token string, headers map[string]string) int {
+	req := gohantest.NewRequest(http.MethodPost, "http://example.com/form", strings.NewReader(url.Values{DefaultField: {token}}.Encode()), headers)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	return gohantest.Serve(s, req).Code
+}
+
+func TestDoubleSubmit(t *testing.T) {
+	s := newTestService(t, Config{TrustedOrigins: []string{"app.example.com"}})
+	cookies, token := form(t, s)
+
+	if _, other := form(t, s); other == token {
+		t.Errorf("Token - Expecting: masked token; Got: the same token twice")
+	}
+
+	tests := []struct {
+		name    string
+		cookies []*http.Cookie
+		token   string
+		headers map[string]string
+		code    int
+	}{
+		{"valid", cookies, token, nil, http.StatusOK},
+		{"same origin", cookies, token, map[string]string{"Origin": "http://example.com"}, http.StatusOK},
+		{"trusted origin", cookies, token, map[string]string{"Origin": "https://app.example.com"}, http.StatusOK},
+		{"unmasked header", cookies, "", map[string]string{DefaultHeader: cookies[0].Value}, http.StatusOK},
+		{"missing token", cookies, "", nil, http.StatusForbidden},
+		{"missing cookie", nil, token, nil, http.StatusForbidden},
+		{"invalid token", cookies, "invalid", nil, http.StatusForbidden},
+		{"other origin", cookies, token, map[string]string{"Origin": "http://evil.com"}, http.StatusForbidden},
+		{"other referer", cookies, token, map[string]string{"Referer": "http://evil.com/form"}, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		if code := post(s, test.cookies, test.token, test.headers); code != test.code {
+			t.Errorf("%s - Expecting: %d; Got: %d", test.name, test.code, code)
+		}
+	}
+}
+
+func TestSignedCookie(t *testing.T) {
+	s := newTestService(t, Config{Secret: []byte("secret")})
+	cookies, token := form(t, s)
+
+	if code := post(s, cookies, token, nil); code != http.StatusOK {
+		t.Errorf("Signed cookie - Expecting: 200; Got: %d", code)
+	}
+
+	// a cookie and a header set by a sibling subdomain
+	forged, err := gohan.GenerateRandomBytes(tokenLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := base64.RawURLEncoding.EncodeToString(forged)
+	for _, cookie := range []string{value, value + "." + value} {
+		forgedCookies := []*http.Cookie{{Name: DefaultCookieName, Value: cookie}}
+		if code := post(s, forgedCookies, "", map[string]string{DefaultHeader: value}); code != http.StatusForbidden {
+			t.Errorf("Unsigned cookie %s - Expecting: 403; Got: %d", cookie, code)
+		}
+	}
+}
+
+func TestMissingReferer(t *testing.T) {
+	s := newTestService(t, Config{})
+	cookies, token := form(t, s)
+
+	req := httptest.NewRequest(http.MethodPost, "https://example.com/form", nil)
+	req.TLS = &tls.ConnectionState{}
+	req.Header.Set(DefaultHeader, token)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	if w := gohantest.Serve(s, req); w.Code != http.StatusForbidden {
+		t.Errorf("Missing referer over https - Expecting: 403; Got: %d", w.Code)
+	}
+}
+
+func TestExemptBearer(t *testing.T) {
+	s := newTestService(t, Config{ExemptBearer: true})
+
+	if code := post(s, nil, "", map[string]string{"Authorization": "Bearer token"}); code != http.StatusOK {
+		t.Errorf("Bearer - Expecting: 200; Got: %d", code)
+	}
+
+	if code := post(s, nil, "", nil); code != http.StatusForbidden {
+		t.Errorf("No bearer - Expecting: 403; Got: %d", code)
+	}
+}
+
+func TestSynchronizerToken(t *testing.T) {
+	sessions, err := session.New(session.Config{Keys: []session.Key{{Hash: []byte("0123456789abcdef0123456789abcdef")}}})
+	if err != nil {
+		t.Fatalf("Session - Expecting: nil; Got: %s", err)
+	}
+
+	s := newTestService(t, Config{UseSession: true}, sessions)
+	cookies, token := form(t, s)
+
+	if len(cookies) != 1 || cookies[0].Name != session.DefaultCookieName {
+		t.Fatalf("Cookies - Expecting: session cookie; Got: %v", cookies)
+	}
+
+	if code := post(s, cookies, token, nil); code != http.StatusOK {
+		t.Errorf("Valid - Expecting: 200; Got: %d", code)
+	}
+
+	if code := post(s, nil, token, nil); code != http.StatusForbidden {
+		t.Errorf("Other session - Expecting: 403; Got: %d", code)
+	}
+}
@@ -0,0 +1,146 @@
+// Package debug exposes the runtime debug endpoints: pprof profiles, expvar,
+// goroutine dumps and the build information of the service.
+//
+// The endpoints should never be public. Register them on the admin endpoints
+// (see option.WithDebugEndpoints) or on a guarded route group:
+//
+//	debug.Register(service.Group("/internal", authMiddleware), service)
+package debug
+
+import (
+	"expvar"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rdebug "runtime/debug"
+	rpprof "runtime/pprof"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/response"
+)
+
+// Registrar is where the endpoints are registered, e.g. *gohan.Admin or *gohan.Group.
+type Registrar interface {
+	GET(path string, handle gohan.HandlerFunc, middlewares ...gohan.MiddlewareFunc) *gohan.Route
+}
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	GoVersion   string `json:"go_version"`
+	Module      string `json:"module,omitempty"`
+	VCS         string `json:"vcs,omitempty"`
+	VCSRevision string `json:"vcs_revision,omitempty"`
+	VCSTime     string `json:"vcs_time,omitempty"`
+	VCSModified bool   `json:"vcs_modified,omitempty"`
+}
+
+// Register adds the debug endpoints:
+//
+//	/debug/pprof             index of the profiles
+//	/debug/pprof/:profile    pprof profiles (heap, goroutine, profile, trace, ...)
+//	/debug/vars              expvar variables
+//	/debug/goroutines        stack traces of all the goroutines
+//	/debug/buildinfo         service name, version and build information
+func Register(r Registrar, s *gohan.Service) {
+	r.GET("/debug/pprof", index)
+	r.GET("/debug/pprof/cmdline", serveHTTP(http.HandlerFunc(pprof.Cmdline)))
+	r.GET("/debug/pprof/profile", serveHTTP(http.HandlerFunc(pprof.Profile)))
+	r.GET("/debug/pprof/symbol", serveHTTP(http.HandlerFunc(pprof.Symbol)))
+	r.GET("/debug/pprof/trace", serveHTTP(http.HandlerFunc(pprof.Trace)))
+
+	for _, p := range rpprof.Profiles() {
+		r.GET("/debug/pprof/"+p.Name(), serveHTTP(pprof.Handler(p.Name())))
+	}
+
+	r.GET("/debug/vars", serveHTTP(expvar.Handler()))
+	r.GET("/debug/goroutines", goroutines)
+	r.GET("/debug/buildinfo", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		response.JSON(w, ReadBuildInfo(s), http.StatusOK)
+	})
+}
+
+// ReadBuildInfo returns the build information of the service binary.
+func ReadBuildInfo(s *gohan.Service) BuildInfo {
+	info := BuildInfo{
+		Name:      s.Name,
+		Version:   s.Version,
+		GoVersion: runtime.Version(),
+	}
+
+	bi, ok := rdebug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.Module = bi.Main.Path
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs":
+			info.VCS = setting.Value
+		case "vcs.revision":
+			info.VCSRevision = setting.Value
+		case "vcs.time":
+			info.VCSTime = setting.Value
+		case "vcs.modified":
+			info.VCSModified = setting.Value == "true"
+		}
+	}
+
+	return info
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<html>
+<head><title>{{.Path}}</title></head>
+<body>
+<p>Profiles:</p>
+<ul>
+{{range .Profiles}}<li><a href="{{$.Path}}/{{.}}?debug=1">{{.}}</a></li>
+{{end}}</ul>
+<p><a href="{{.Path}}/profile">CPU profile</a> (30 seconds by default, see the seconds parameter)</p>
+</body>
+</html>
+`))
+
+// index lists the profiles. pprof.Index can't be used because it expects to be
+// served at /debug/pprof/, which the router doesn't allow.
+func index(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+	var profiles []string
+	for _, p := range rpprof.Profiles() {
+		profiles = append(profiles, p.Name())
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	err := indexTemplate.Execute(w, struct {
+		Path     string
+		Profiles []string
+	}{
+		Path:     req.URL.Path,
+		Profiles: profiles,
+	})
+
+	if err != nil {
+		sc.Logger.Errorf("failed rendering the pprof index: %+v", err)
+	}
+}
+
+// goroutines writes the stack traces of all the current goroutines.
+func goroutines(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if err := rpprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		response.String(w, fmt.Sprintf("failed dumping the goroutines: %s", err), http.StatusInternalServerError)
+	}
+}
+
+func serveHTTP(h http.Handler) gohan.HandlerFunc {
+	return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(w, req)
+	}
+}
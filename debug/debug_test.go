@@ -0,0 +1,58 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/internal/gohantest"
+)
+
+func TestRegister(t *testing.T) {
+	s := gohantest.NewService(t)
+	s.Name = "users"
+	s.Version = "1.2.0"
+
+	var guarded int
+	Register(s.Group("/internal", func(next gohan.HandlerFunc) gohan.HandlerFunc {
+		return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+			guarded++
+			next(sc, w, req)
+		}
+	}), s)
+
+	tt := []struct {
+		path     string
+		contains string
+	}{
+		{path: "/internal/debug/pprof", contains: "/internal/debug/pprof/heap?debug=1"},
+		{path: "/internal/debug/pprof/goroutine?debug=1", contains: "goroutine profile"},
+		{path: "/internal/debug/vars", contains: "memstats"},
+		{path: "/internal/debug/goroutines", contains: "goroutine"},
+	}
+
+	for _, tc := range tt {
+		w := gohantest.Get(s, tc.path, nil)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tc.contains) {
+			t.Errorf("GET %s - Expecting: 200 containing %s; Got: %d", tc.path, tc.contains, w.Code)
+		}
+	}
+
+	w := gohantest.Get(s, "/internal/debug/buildinfo", nil)
+
+	var info BuildInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("GET buildinfo - Expecting: json; Got: %s", w.Body.String())
+	}
+
+	if info.Name != "users" || info.Version != "1.2.0" || info.GoVersion != runtime.Version() {
+		t.Errorf("GET buildinfo - Expecting: users 1.2.0 %s; Got: %+v", runtime.Version(), info)
+	}
+
+	if guarded != len(tt)+1 {
+		t.Errorf("Group middleware - Expecting: %d calls; Got: %d", len(tt)+1, guarded)
+	}
+}
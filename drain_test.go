@@ -0,0 +1,88 @@
+package gohan
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type flushTracer struct {
+	nullTracer
+	flushed chan struct{}
+}
+
+func (t *flushTracer) HTTPHandler(h http.Handler) http.Handler {
+	return h
+}
+
+func (t *flushTracer) Flush(ctx context.Context) error {
+	close(t.flushed)
+	return nil
+}
+
+func TestDrainDelay(t *testing.T) {
+	tracer := &flushTracer{flushed: make(chan struct{})}
+
+	s := newTestService(t)
+	s.Server.DrainDelay = 300 * time.Millisecond
+	s.Tracer = tracer
+	s.GET("/ping", func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {})
+
+	var stopped bool
+	s.OnStop(func(ctx context.Context) error {
+		stopped = true
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx, ln)
+	}()
+
+	cancel()
+
+	// Wait for the shutdown to begin
+	for i := 0; i < 100 && !s.Health.IsShuttingDown(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	w := httptest.NewRecorder()
+	s.Health.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Readiness while draining - Expecting: 503; Got: %d", w.Code)
+	}
+
+	res, err := http.Get("http://" + ln.Addr().String() + "/ping")
+	if err != nil {
+		t.Fatalf("GET /ping while draining - Expecting: nil; Got: %s", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("GET /ping while draining - Expecting: 200; Got: %d", res.StatusCode)
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("Serve - Expecting: nil; Got: %s", err)
+	}
+
+	if !stopped {
+		t.Errorf("Expecting the stop hooks to be called")
+	}
+
+	select {
+	case <-tracer.flushed:
+	default:
+		t.Errorf("Expecting the tracer to be flushed")
+	}
+}
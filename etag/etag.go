@@ -0,0 +1,185 @@
+// Package etag contains a middleware adding entity tags to the GET responses and
+// handling the conditional requests:
+//
+//	service.Use(etag.New(etag.Config{}))
+//
+// The clients sending If-None-Match or If-Modified-Since get a 304 response when their
+// copy is still valid. With Config.Current, the PUT, PATCH and DELETE requests sending
+// If-Match or If-Unmodified-Since get a 412 response when the resource was modified.
+// The handlers can also check the preconditions with response.PreconditionFailed.
+package etag
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/response"
+)
+
+// DefaultMaxSize is the size of the largest response buffered to compute its ETag.
+const DefaultMaxSize = 1 << 20
+
+// CurrentFunc returns the ETag and the last modification time of the resource of the
+// request. An empty ETag means the resource doesn't exist.
+type CurrentFunc func(sc *gohan.ServiceContext, req *http.Request) (etag string, lastModified time.Time, err error)
+
+// Config contains the settings of the middleware.
+type Config struct {
+	// Generates weak ETags, for the responses that are equivalent but not byte for byte
+	// identical. The compress middleware gives its own strong tags to the compressed ones.
+	Weak bool
+
+	// Responses larger than MaxSize bytes or flushed by the handler are sent without
+	// ETag. Defaults to DefaultMaxSize.
+	MaxSize int
+
+	// Returns the state of the resource to check the preconditions of the PUT, PATCH
+	// and DELETE requests. They aren't checked when nil.
+	Current CurrentFunc
+}
+
+// New returns the conditional requests middleware.
+func New(config Config) gohan.MiddlewareFunc {
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultMaxSize
+	}
+
+	return func(next gohan.HandlerFunc) gohan.HandlerFunc {
+		return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+			switch req.Method {
+			case http.MethodGet, http.MethodHead:
+				ew := &etagWriter{ResponseWriter: w, config: &config}
+				next(sc, ew, req)
+				ew.close(req)
+
+			case http.MethodPut, http.MethodPatch, http.MethodDelete:
+				if config.Current != nil && (req.Header.Get("If-Match") != "" || req.Header.Get("If-Unmodified-Since") != "") {
+					etag, lastModified, err := config.Current(sc, req)
+					if err != nil {
+						sc.Logger.Errorf("failed getting the current state of the resource: %+v", err)
+						response.Problem(w, http.StatusInternalServerError, "failed checking the preconditions")
+						return
+					}
+
+					if response.PreconditionFailed(w, req, etag, lastModified) {
+						sc.Logger.Infof("precondition failed for %s", req.URL.Path)
+						return
+					}
+				}
+				next(sc, w, req)
+
+			default:
+				next(sc, w, req)
+			}
+		}
+	}
+}
+
+// etagWriter buffers the successful responses to compute their ETag. The other
+// responses, the large ones and the flushed ones are written directly.
+type etagWriter struct {
+	http.ResponseWriter
+
+	config      *Config
+	code        int
+	wroteHeader bool
+	passthrough bool
+	buf         []byte
+}
+
+func (w *etagWriter) WriteHeader(code int) {
+	if w.wroteHeader || w.passthrough {
+		return
+	}
+
+	if code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.code = code
+	w.wroteHeader = true
+
+	if code != http.StatusOK {
+		w.pass()
+	}
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+
+	if len(w.buf)+len(b) > w.config.MaxSize {
+		if err := w.pass(); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	return len(b), nil
+}
+
+func (w *etagWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	w.pass()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original writer, see http.ResponseController.
+func (w *etagWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// pass writes the headers and the buffered data, the next writes aren't buffered.
+func (w *etagWriter) pass() error {
+	if w.passthrough {
+		return nil
+	}
+
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.code)
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	_, err := w.ResponseWriter.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// close adds the ETag to the buffered response and writes it, or a 304 response.
+func (w *etagWriter) close(req *http.Request) {
+	if w.passthrough || !w.wroteHeader {
+		return
+	}
+
+	h := w.ResponseWriter.Header()
+
+	// the HEAD responses have no body to compute the ETag from
+	if h.Get("ETag") == "" && req.Method == http.MethodGet {
+		if w.config.Weak {
+			h.Set("ETag", response.WeakETag(w.buf))
+		} else {
+			h.Set("ETag", response.ETag(w.buf))
+		}
+	}
+
+	if response.NotModified(w.ResponseWriter, req) {
+		return
+	}
+
+	w.pass()
+}
@@ -0,0 +1,104 @@
+package etag
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/internal/gohantest"
+	"github.com/appnaconda/gohan/response"
+)
+
+func newTestService(t *testing.T, config Config) *gohan.Service {
+	t.Helper()
+
+	s := gohantest.NewService(t)
+	s.Use(New(config))
+
+	s.GET("/item", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		response.JSON(w, map[string]string{"name": "gohan"}, http.StatusOK)
+	})
+	s.GET("/missing", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		response.Problem(w, http.StatusNotFound, "no such item")
+	})
+	s.PUT("/item", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		response.NoContent(w, http.StatusNoContent)
+	})
+
+	return s
+}
+
+func TestETag(t *testing.T) {
+	s := newTestService(t, Config{})
+
+	w := gohantest.Do(s, http.MethodGet, "/item", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("GET - Expecting: 200 with a strong ETag; Got: %d %q", w.Code, etag)
+	}
+
+	if !strings.Contains(w.Body.String(), "gohan") {
+		t.Errorf("GET - Expecting: the body; Got: %q", w.Body.String())
+	}
+
+	w = gohantest.Do(s, http.MethodGet, "/item", map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match - Expecting: 304 without body; Got: %d %q", w.Code, w.Body.String())
+	}
+
+	w = gohantest.Do(s, http.MethodGet, "/item", map[string]string{"If-None-Match": `"stale"`})
+	if w.Code != http.StatusOK {
+		t.Errorf("Stale If-None-Match - Expecting: 200; Got: %d", w.Code)
+	}
+
+	if w = gohantest.Do(s, http.MethodGet, "/missing", nil); w.Code != http.StatusNotFound || w.Header().Get("ETag") != "" {
+		t.Errorf("Error - Expecting: 404 without ETag; Got: %d %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestWeakETag(t *testing.T) {
+	s := newTestService(t, Config{Weak: true})
+
+	if etag := gohantest.Do(s, http.MethodGet, "/item", nil).Header().Get("ETag"); !strings.HasPrefix(etag, "W/") {
+		t.Errorf("Weak - Expecting: W/ ETag; Got: %q", etag)
+	}
+}
+
+func TestLargeResponse(t *testing.T) {
+	s := newTestService(t, Config{MaxSize: 4})
+
+	w := gohantest.Do(s, http.MethodGet, "/item", nil)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != "" || !strings.Contains(w.Body.String(), "gohan") {
+		t.Errorf("Large - Expecting: 200 without ETag; Got: %d %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestPreconditions(t *testing.T) {
+	current := response.ETag([]byte("v2"))
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	s := newTestService(t, Config{
+		Current: func(sc *gohan.ServiceContext, req *http.Request) (string, time.Time, error) {
+			return current, modified, nil
+		},
+	})
+
+	tests := []struct {
+		headers  map[string]string
+		expected int
+	}{
+		{map[string]string{"If-Match": current}, http.StatusNoContent},
+		{map[string]string{"If-Match": response.ETag([]byte("v1"))}, http.StatusPreconditionFailed},
+		{map[string]string{"If-Unmodified-Since": modified.Format(http.TimeFormat)}, http.StatusNoContent},
+		{map[string]string{"If-Unmodified-Since": modified.Add(-time.Minute).Format(http.TimeFormat)}, http.StatusPreconditionFailed},
+		{nil, http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		if w := gohantest.Do(s, http.MethodPut, "/item", test.headers); w.Code != test.expected {
+			t.Errorf("%v - Expecting: %d; Got: %d", test.headers, test.expected, w.Code)
+		}
+	}
+}
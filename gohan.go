@@ -4,23 +4,73 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/appnaconda/gohan/database"
+	"github.com/appnaconda/gohan/health"
 	"github.com/appnaconda/gohan/logger"
 	"github.com/appnaconda/gohan/logger/logrus"
 	"github.com/appnaconda/gohan/logger/option"
+	"github.com/appnaconda/gohan/metrics"
 	"github.com/appnaconda/gohan/router"
-	"github.com/rs/cors"
 )
 
 type HandlerFunc func(*ServiceContext, http.ResponseWriter, *http.Request)
 type MiddlewareFunc func(HandlerFunc) HandlerFunc
 
+// middlewareList holds the middlewares added with Use. They are fixed once the
+// service starts serving, so the handlers chains are only built once.
+type middlewareList struct {
+	mu     sync.Mutex
+	list   []MiddlewareFunc
+	sealed bool
+}
+
+// add appends the middlewares, it panics once the list is sealed.
+func (l *middlewareList) add(middlewares []MiddlewareFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.sealed {
+		panic("gohan - Use called after the service started serving")
+	}
+
+	l.list = append(l.list, middlewares...)
+}
+
+// seal prevents adding middlewares and returns them.
+func (l *middlewareList) seal() []MiddlewareFunc {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sealed = true
+	return l.list
+}
+
+// wrap returns the handler wrapped with the middlewares of the list. The chain is
+// built on the first request, sealing the list.
+func (l *middlewareList) wrap(h HandlerFunc) HandlerFunc {
+	var once sync.Once
+	var chain HandlerFunc
+
+	return func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		once.Do(func() {
+			chain = h
+			for _, middleware := range l.seal() {
+				chain = middleware(chain)
+			}
+		})
+
+		chain(sc, w, req)
+	}
+}
+
 type Option interface {
 	Apply(*Service) error
 }
@@ -33,26 +83,58 @@ type Service struct {
 	router     *router.Router
 	db         *sql.DB
 	HttpClient *http.Client
-	Tracer     Tracer
-}
 
-func New(ctx context.Context, opts ...Option) (*Service, error) {
-	logLevel := logger.DEBUG
-	logFormat := logger.JSON_FORMAT
+	// Tracer of the requests, it must be set before the service starts serving.
+	Tracer Tracer
 
-	logLevelValue := os.Getenv("LOG_LEVEL")
-	if logLevelValue != "" {
-		if level, ok := logger.ParseLevel(logLevelValue); ok {
-			logLevel = level
-		}
-	}
+	// Middlewares applied to every route, see Use.
+	middlewares middlewareList
 
-	logFormatValue := os.Getenv("LOG_FORMAT")
-	if logFormatValue != "" {
-		if format, ok := logger.ParseFormat(logFormatValue); ok {
-			logFormat = format
-		}
-	}
+	// Registered routes, see Routes.
+	routesMu sync.RWMutex
+	routes   []*Route
+
+	// Settings of the http servers started by Run and Serve.
+	Server ServerConfig
+
+	// Serves https when set.
+	TLS *TLSConfig
+
+	// Health checks exposed by the liveness and readiness endpoints.
+	Health *health.Registry
+
+	// Request metrics. Nothing is recorded when nil.
+	Metrics *metrics.Metrics
+
+	// Internal endpoints, served on a separate listener when its address is set.
+	Admin *Admin
+
+	// CORS policy applied to every route, it must be set before the service starts
+	// serving. CORS is disabled when nil.
+	CORS          *CORSPolicy
+	corsOverrides corsOverrideList
+
+	lifecycle lifecycle
+
+	logMu     sync.RWMutex
+	logLevel  logger.Level
+	logFormat logger.Format
+
+	reloadMu sync.Mutex
+	onReload []HookFunc
+	certs    *certReloader
+
+	configMu sync.RWMutex
+	config   interface{}
+
+	handlerOnce sync.Once
+	handler     http.Handler
+
+	closeOnce sync.Once
+}
+
+func New(ctx context.Context, opts ...Option) (*Service, error) {
+	logLevel, logFormat := logSettingsFromEnv(logger.DEBUG, logger.JSON_FORMAT)
 
 	service := &Service{
 		Context: ctx,
@@ -62,8 +144,14 @@ func New(ctx context.Context, opts ...Option) (*Service, error) {
 		),
 		router:     router.New(),
 		HttpClient: http.DefaultClient,
+		Health:     health.New(),
+		Server:     DefaultServerConfig(),
+		logLevel:   logLevel,
+		logFormat:  logFormat,
 	}
 
+	service.Admin = newAdmin(service)
+
 	if _, found := os.LookupEnv("DB_CONN_STR"); found {
 		db, err := database.New(service.Context)
 		if err != nil {
@@ -71,6 +159,10 @@ func New(ctx context.Context, opts ...Option) (*Service, error) {
 		}
 
 		service.db = db
+
+		if err := service.Health.Register(health.Check{Name: "database", Func: db.PingContext}); err != nil {
+			return nil, err
+		}
 	}
 
 	for _, opt := range opts {
@@ -82,42 +174,97 @@ func New(ctx context.Context, opts ...Option) (*Service, error) {
 	return service, nil
 }
 
-func (s *Service) GET(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) {
-	s.Handle(http.MethodGet, path, handle, middlewares...)
+// logSettingsFromEnv reads the log level and format from the LOG_LEVEL and LOG_FORMAT
+// env variables. The given values are returned when they are not set or invalid.
+func logSettingsFromEnv(level logger.Level, format logger.Format) (logger.Level, logger.Format) {
+	logLevelValue := os.Getenv("LOG_LEVEL")
+	if logLevelValue != "" {
+		if l, ok := logger.ParseLevel(logLevelValue); ok {
+			level = l
+		}
+	}
+
+	logFormatValue := os.Getenv("LOG_FORMAT")
+	if logFormatValue != "" {
+		if f, ok := logger.ParseFormat(logFormatValue); ok {
+			format = f
+		}
+	}
+
+	return level, format
+}
+
+func (s *Service) GET(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return s.Handle(http.MethodGet, path, handle, middlewares...)
+}
+
+func (s *Service) HEAD(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return s.Handle(http.MethodHead, path, handle, middlewares...)
 }
 
-func (s *Service) HEAD(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) {
-	s.Handle(http.MethodHead, path, handle, middlewares...)
+func (s *Service) OPTIONS(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return s.Handle(http.MethodOptions, path, handle, middlewares...)
 }
 
-func (s *Service) OPTIONS(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) {
-	s.Handle(http.MethodOptions, path, handle, middlewares...)
+func (s *Service) POST(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return s.Handle(http.MethodPost, path, handle, middlewares...)
 }
 
-func (s *Service) POST(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) {
-	s.Handle(http.MethodPost, path, handle, middlewares...)
+func (s *Service) PUT(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return s.Handle(http.MethodPut, path, handle, middlewares...)
 }
 
-func (s *Service) PUT(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) {
-	s.Handle(http.MethodPut, path, handle, middlewares...)
+func (s *Service) PATCH(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return s.Handle(http.MethodPatch, path, handle, middlewares...)
 }
 
-func (s *Service) PATCH(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) {
-	s.Handle(http.MethodPatch, path, handle, middlewares...)
+func (s *Service) DELETE(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return s.Handle(http.MethodDelete, path, handle, middlewares...)
 }
 
-func (s *Service) DELETE(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) {
-	s.Handle(http.MethodDelete, path, handle, middlewares...)
+func (s *Service) Handle(method string, path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return s.handle(method, path, handle, nil, middlewares...)
 }
 
-func (s *Service) Handle(method string, path string, handle HandlerFunc, middlewares ...MiddlewareFunc) {
+// handle registers the route. The authorization rules are checked after the middlewares,
+// so they can rely on the authentication ones.
+func (s *Service) handle(method string, path string, handle HandlerFunc, group *Group, middlewares ...MiddlewareFunc) *Route {
+	name := GetFuncName(handle)
+	route := &Route{Method: method, Pattern: path, Handler: name, group: group}
+
+	handle = s.authorize(route, handle)
 	for _, middleware := range middlewares {
 		handle = middleware(handle)
 	}
-	s.router.Handle(method, path, s.wrapHandle(handle))
+
+	// The service middlewares are applied on the first request so they
+	// can be added after the routes.
+	s.router.Handle(method, path, s.instrument(method, path, s.wrapHandle(name, s.limit(route, s.middlewares.wrap(handle)))))
+
+	s.addRoute(route)
+	return route
+}
+
+// Use adds middlewares applied to every route of the service. They wrap the group and
+// route middlewares. The admin endpoints have their own middlewares, see Admin.Use.
+// It panics once the service started serving.
+func (s *Service) Use(middlewares ...MiddlewareFunc) {
+	s.middlewares.add(middlewares)
+}
+
+// instrument records the request metrics when they are enabled.
+func (s *Service) instrument(method, pattern string, h router.HandlerFunc) router.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if s.Metrics == nil {
+			h(w, req)
+			return
+		}
+
+		s.Metrics.Instrument(method, pattern, http.HandlerFunc(h))(w, req)
+	}
 }
 
-func (s *Service) wrapHandle(h HandlerFunc) router.HandlerFunc {
+func (s *Service) wrapHandle(name string, h HandlerFunc) router.HandlerFunc {
 	next := func(w http.ResponseWriter, req *http.Request) {
 
 		requestUuid, err := NewUUID()
@@ -125,20 +272,31 @@ func (s *Service) wrapHandle(h HandlerFunc) router.HandlerFunc {
 			s.Logger.Warnf("failed generating a new request UUID: %+v", err)
 		}
 
-		traceUuid, err := NewUUID()
-		if err != nil {
-			s.Logger.Warnf("failed generating a new trace UUID: %+v", err)
+		// The trace is continued when the caller sends its id, see ServiceContext.HttpClient
+		traceUuid := incomingTraceID(req)
+		if traceUuid == "" {
+			traceUuid, err = NewUUID()
+			if err != nil {
+				s.Logger.Warnf("failed generating a new trace UUID: %+v", err)
+			}
 		}
 
 		serviceContext := &ServiceContext{
 			Logger: s.Logger.With(logger.Fields{
 				"request_uuid": requestUuid,
 				"trace_id":     traceUuid,
-				"handler":      GetFuncName(h),
+				"handler":      name,
 			}),
-			db:         s.db,
-			Context:    s.Context,
-			HttpClient: s.HttpClient,
+			db:        s.db,
+			Context:   req.Context(),
+			RequestID: requestUuid,
+			TraceID:   traceUuid,
+		}
+		serviceContext.HttpClient = requestClient(s.HttpClient, serviceContext)
+
+		if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+			serviceContext.ClientCertificate = req.TLS.VerifiedChains[0][0]
+			serviceContext.ClientCertificateSubject = serviceContext.ClientCertificate.Subject.String()
 		}
 
 		h(serviceContext, w, req)
@@ -149,7 +307,13 @@ func (s *Service) wrapHandle(h HandlerFunc) router.HandlerFunc {
 	return next
 }
 
-func (s *Service) Run(port int) {
+// Handler returns the service http handler: the router wrapped with the tracer and the CORS policy.
+// It can be used to test the routes with httptest or to embed the service in another server.
+// The tracer, the CORS policies and the middlewares are fixed once it is called: Use and
+// Group.CORS panic afterwards. The routes can still be added.
+func (s *Service) Handler() http.Handler {
+	s.middlewares.seal()
+
 	var handler http.Handler
 
 	if s.Tracer != nil {
@@ -158,23 +322,194 @@ func (s *Service) Run(port int) {
 		handler = s.router
 	}
 
-	handler = cors.AllowAll().Handler(handler)
+	return s.corsHandler(handler)
+}
 
-	s.Logger.Debugf("Starting Service on port %d", port)
+// ServeHTTP serves the request using the service handler, built by Handler on the
+// first request. The service must be configured before, see Handler.
+func (s *Service) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.handlerOnce.Do(func() {
+		s.handler = s.Handler()
+	})
 
-	server := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: handler}
+	s.handler.ServeHTTP(w, req)
+}
+
+// Run starts the service on the given port and blocks until SIGINT or SIGTERM is
+// received. SIGHUP reloads the service, see Reload. The port is ignored when the
+// server is configured to use a unix socket or socket activation.
+// It returns an error if the service can't listen on the port or the server fails.
+func (s *Service) Run(port int) error {
+	ln, err := s.listen(port)
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Debugf("Starting Service on %s", ln.Addr())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// SIGINT and SIGTERM shutdown the service, a second one skips the drain delay and
+	// the graceful shutdown. SIGHUP reloads the service.
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(c)
+
+	abort := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
 
 	go func() {
-		server.ListenAndServe()
+		for {
+			select {
+			case sig := <-c:
+				s.Logger.Debugf("Signal received: %+v", sig)
+
+				if sig == syscall.SIGHUP {
+					if err := s.Reload(ctx); err != nil {
+						s.Logger.Errorf("failed reloading the service: %+v", err)
+					}
+					continue
+				}
+
+				if ctx.Err() != nil {
+					s.Logger.Infof("Signal received again, stopping now")
+					close(abort)
+					return
+				}
+
+				cancel()
+			case <-done:
+				return
+			}
+		}
 	}()
 
-	c := make(chan os.Signal, 2)
-	signal.Notify(c, os.Interrupt, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTTIN)
+	defer s.Close()
+	return s.serve(ctx, ln, abort)
+}
+
+// Serve accepts connections on the listener until the context is done, then shuts the
+// server down gracefully. Unlike Run, it doesn't install any signal handler nor close
+// the service, so it can serve again. Call Close once done.
+func (s *Service) Serve(ctx context.Context, ln net.Listener) error {
+	return s.serve(ctx, ln, nil)
+}
+
+// serve is Serve, closing abort skips the drain delay and cancels the graceful shutdown.
+func (s *Service) serve(ctx context.Context, ln net.Listener, abort <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.Admin.middlewares.seal()
+
+	server := s.newHTTPServer(s.Handler())
+
+	if s.TLS != nil {
+		certs, err := newCertReloader(*s.TLS)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+
+		server.TLSConfig = certs.TLSConfig()
+
+		s.reloadMu.Lock()
+		s.certs = certs
+		s.reloadMu.Unlock()
+
+		go certs.watch(ctx, func(err error) {
+			s.Logger.Errorf("failed reloading the tls certificates: %+v", err)
+		})
+	}
+
+	var adminLn net.Listener
+	if s.Admin.Addr != "" {
+		var err error
+		if adminLn, err = net.Listen("tcp", s.Admin.Addr); err != nil {
+			ln.Close()
+			return fmt.Errorf("failed listening on %s: %w", s.Admin.Addr, err)
+		}
+	}
+
+	if err := s.start(ctx); err != nil {
+		ln.Close()
+		if adminLn != nil {
+			adminLn.Close()
+		}
+		return err
+	}
+
+	var adminServer *http.Server
+	if adminLn != nil {
+		s.Logger.Debugf("Starting admin server on %s", s.Admin.Addr)
+
+		adminServer = s.newHTTPServer(s.Admin.Handler())
+		go func() {
+			if err := adminServer.Serve(adminLn); err != nil && err != http.ErrServerClosed {
+				s.Logger.Errorf("admin server failed: %+v", err)
+			}
+		}()
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			serverErr <- server.ServeTLS(ln, "", "")
+		} else {
+			serverErr <- server.Serve(ln)
+		}
+	}()
 
-	sig := <-c
-	s.Logger.Debugf("Signal received: %+v", sig)
+	var err error
+	drain := true
+	select {
+	case err = <-serverErr:
+		if err == http.ErrServerClosed {
+			err = nil
+		}
+		// there's nothing to drain if the server stopped by itself
+		drain = false
+	case err = <-s.workerFailed():
+	case <-ctx.Done():
+	}
+
+	s.shutdown(server, adminServer, drain, abort)
+
+	return err
+}
+
+// shutdown stops the service in order: readiness starts failing, the requests keep being
+// served during the drain delay, then the http servers are shutdown, the background workers
+// stopped, the stop hooks called and the tracer flushed. Closing abort ends the drain delay
+// and cancels the shutdown context.
+func (s *Service) shutdown(server, adminServer *http.Server, drain bool, abort <-chan struct{}) {
+	s.Health.SetShuttingDown()
+
+	base, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
+	go func() {
+		select {
+		case <-abort:
+			cancelBase()
+		case <-base.Done():
+		}
+	}()
+
+	if drain && s.Server.DrainDelay > 0 {
+		s.Logger.Debugf("waiting %s for the load balancers to stop sending traffic", s.Server.DrainDelay)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		timer := time.NewTimer(s.Server.DrainDelay)
+		select {
+		case <-timer.C:
+		case <-base.Done():
+			timer.Stop()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(base, s.shutdownTimeout())
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
@@ -182,16 +517,64 @@ func (s *Service) Run(port int) {
 	} else {
 		s.Logger.Debugf("the http server was shutdown gracefully")
 	}
+
+	s.stop(ctx)
+
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			s.Logger.Errorf("failed shutting down the admin server: %+v", err)
+		}
+	}
+
+	if flusher, ok := s.Tracer.(TracerFlusher); ok {
+		if err := flusher.Flush(ctx); err != nil {
+			s.Logger.Errorf("failed flushing the tracer: %+v", err)
+		}
+	}
+}
+
+// LogLevel returns the current log level of the service logger.
+func (s *Service) LogLevel() logger.Level {
+	s.logMu.RLock()
+	defer s.logMu.RUnlock()
+
+	return s.logLevel
+}
+
+// SetLogLevel changes the log level of the service logger.
+func (s *Service) SetLogLevel(level logger.Level) error {
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+
+	if err := s.Logger.SetLevel(level); err != nil {
+		return err
+	}
+
+	s.logLevel = level
+	return nil
 }
 
+// GetDB returns the service database connection.
+func (s *Service) GetDB() (*sql.DB, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("no databse connection was found")
+	}
+
+	return s.db, nil
+}
+
+// Close releases the service resources. It is called by Run on shutdown, calling it
+// more than once has no effect.
 func (s *Service) Close() {
-	s.Logger.Debug("shutting down the service")
-	if s.db != nil {
-		err := s.db.Close()
-		if err != nil {
-			s.Logger.Errorf("failed closing the database connection: %s", err)
+	s.closeOnce.Do(func() {
+		s.Logger.Debug("shutting down the service")
+		if s.db != nil {
+			err := s.db.Close()
+			if err != nil {
+				s.Logger.Errorf("failed closing the database connection: %s", err)
+			}
 		}
-	}
 
-	s.Logger.Debug("the service was shutdown gracefully")
+		s.Logger.Debug("the service was shutdown gracefully")
+	})
 }
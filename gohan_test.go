@@ -0,0 +1,168 @@
+package gohan
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/appnaconda/gohan/request"
+	"github.com/appnaconda/gohan/response"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+
+	s, err := New(context.Background())
+	if err != nil {
+		t.Fatalf("New - Expecting: nil; Got: %s", err)
+	}
+
+	s.Logger.SetOutput(ioutil.Discard)
+
+	return s
+}
+
+func TestServeHTTP(t *testing.T) {
+	s := newTestService(t)
+	s.GET("/users/:id", func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		response.String(w, request.PathParam(req, "id"), http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/10", nil))
+
+	if w.Code != http.StatusOK || w.Body.String() != "10" {
+		t.Errorf("Expecting: 200 10; Got: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/accounts", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expecting: 404; Got: %d", w.Code)
+	}
+}
+
+func TestConfigureBeforeServing(t *testing.T) {
+	s := newTestService(t)
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	// the routes can be added after the first request
+	s.GET("/ping", func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("pong"))
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	if w.Body.String() != "pong" {
+		t.Errorf("Route added after serving - Expecting: pong; Got: %d %s", w.Code, w.Body.String())
+	}
+
+	// not the middlewares, even if no route was served yet
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Use after serving - Expecting: panic")
+		}
+	}()
+
+	s.Use(func(next HandlerFunc) HandlerFunc { return next })
+}
+
+func TestUse(t *testing.T) {
+	s := newTestService(t)
+	s.GET("/ping", func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {})
+
+	// added after the route, the chain is built on the first request
+	var built, calls int
+	s.Use(func(next HandlerFunc) HandlerFunc {
+		built++
+		return func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+			calls++
+			next(sc, w, req)
+		}
+	})
+
+	for i := 0; i < 3; i++ {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+	}
+
+	if built != 1 || calls != 3 {
+		t.Errorf("Middleware - Expecting: built once, 3 calls; Got: built %d, %d calls", built, calls)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Use after serving - Expecting: panic")
+		}
+	}()
+
+	s.Use(func(next HandlerFunc) HandlerFunc { return next })
+}
+
+func TestServe(t *testing.T) {
+	s := newTestService(t)
+	s.GET("/ping", func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		response.String(w, "pong", http.StatusOK)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx, ln)
+	}()
+
+	res, err := http.Get("http://" + ln.Addr().String() + "/ping")
+	if err != nil {
+		t.Fatalf("GET /ping - Expecting: nil; Got: %s", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("GET /ping - Expecting: 200; Got: %d", res.StatusCode)
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve - Expecting: nil; Got: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Serve - Expecting to return after the context is done")
+	}
+}
+
+func TestRunPortInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	s := newTestService(t)
+	s.Server.Host = "127.0.0.1"
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(ln.Addr().(*net.TCPAddr).Port)
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Run - Expecting: error; Got: nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Run - Expecting to fail when the port is in use")
+	}
+}
@@ -0,0 +1,126 @@
+package gohan
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Group is a set of routes sharing a path prefix and middlewares.
+type Group struct {
+	service     *Service
+	prefix      string
+	middlewares []MiddlewareFunc
+
+	parent *Group
+
+	mu    sync.RWMutex
+	rules []AuthRule
+}
+
+// Group creates a new route group. The middlewares are applied to every route of the group
+// and wrap the route middlewares.
+func (s *Service) Group(prefix string, middlewares ...MiddlewareFunc) *Group {
+	return &Group{
+		service:     s,
+		prefix:      cleanPrefix(prefix),
+		middlewares: middlewares,
+	}
+}
+
+// Group creates a nested group inheriting the prefix and middlewares of its parent.
+func (g *Group) Group(prefix string, middlewares ...MiddlewareFunc) *Group {
+	// The parent middlewares go last so they wrap the nested ones.
+	mws := make([]MiddlewareFunc, 0, len(middlewares)+len(g.middlewares))
+	mws = append(mws, middlewares...)
+	mws = append(mws, g.middlewares...)
+
+	return &Group{
+		service:     g.service,
+		prefix:      g.prefix + cleanPrefix(prefix),
+		middlewares: mws,
+		parent:      g,
+	}
+}
+
+// Prefix returns the group path prefix.
+func (g *Group) Prefix() string {
+	return g.prefix
+}
+
+// Authorize adds authorization rules to every route of the group and its nested groups,
+// including the routes already registered.
+func (g *Group) Authorize(rules ...AuthRule) *Group {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.rules = append(g.rules, rules...)
+	return g
+}
+
+// Rules returns the authorization rules of the group, the ones of its parents first.
+func (g *Group) Rules() []AuthRule {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var rules []AuthRule
+	if g.parent != nil {
+		rules = g.parent.Rules()
+	}
+
+	return append(rules, g.rules...)
+}
+
+// CORS overrides the service CORS policy for every path under the group prefix.
+// A nil policy disables CORS for the group. It panics once the service started serving.
+func (g *Group) CORS(policy *CORSPolicy) {
+	g.service.corsOverrides.add(corsOverride{prefix: g.prefix, policy: policy})
+}
+
+func (g *Group) GET(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return g.Handle(http.MethodGet, path, handle, middlewares...)
+}
+
+func (g *Group) HEAD(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return g.Handle(http.MethodHead, path, handle, middlewares...)
+}
+
+func (g *Group) OPTIONS(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return g.Handle(http.MethodOptions, path, handle, middlewares...)
+}
+
+func (g *Group) POST(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return g.Handle(http.MethodPost, path, handle, middlewares...)
+}
+
+func (g *Group) PUT(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return g.Handle(http.MethodPut, path, handle, middlewares...)
+}
+
+func (g *Group) PATCH(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return g.Handle(http.MethodPatch, path, handle, middlewares...)
+}
+
+func (g *Group) DELETE(path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	return g.Handle(http.MethodDelete, path, handle, middlewares...)
+}
+
+func (g *Group) Handle(method string, path string, handle HandlerFunc, middlewares ...MiddlewareFunc) *Route {
+	// Service.Handle wraps the handler with the middlewares in order, so the
+	// group ones go last to wrap the route ones.
+	mws := make([]MiddlewareFunc, 0, len(middlewares)+len(g.middlewares))
+	mws = append(mws, middlewares...)
+	mws = append(mws, g.middlewares...)
+
+	return g.service.handle(method, g.prefix+path, handle, g, mws...)
+}
+
+// cleanPrefix makes sure the prefix starts with / and has no trailing /.
+func cleanPrefix(prefix string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix != "" && prefix[0] != '/' {
+		prefix = "/" + prefix
+	}
+
+	return prefix
+}
@@ -0,0 +1,244 @@
+// Package health contains a registry of named health checks and the http handlers
+// exposing them as liveness and readiness endpoints.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Default values used when the check doesn't define its own.
+const (
+	DefaultTimeout  = 5 * time.Second
+	DefaultCacheTTL = 1 * time.Second
+)
+
+// CheckFunc returns an error when the checked component is not healthy.
+type CheckFunc func(ctx context.Context) error
+
+// Check is a named health check.
+type Check struct {
+	Name string
+	Func CheckFunc
+
+	// Maximum time the check can take before failing. DefaultTimeout is used when zero.
+	Timeout time.Duration
+
+	// How long the result is reused before running the check again. DefaultCacheTTL is used when zero.
+	CacheTTL time.Duration
+
+	// Liveness checks are evaluated by the liveness endpoint too. Only checks whose failure
+	// requires a restart of the process should be liveness checks.
+	Liveness bool
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the json body returned by the health endpoints.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+type entry struct {
+	check Check
+
+	mu     sync.Mutex
+	result Result
+	expire time.Time
+}
+
+// Registry holds the registered checks.
+type Registry struct {
+	mu           sync.RWMutex
+	entries      []*entry
+	shuttingDown int32
+}
+
+// New returns an empty registry.
+func New() *Registry {
+	return &Registry{}
+}
+
+// Register adds a new check to the registry. Registering a name twice returns an error.
+func (r *Registry) Register(check Check) error {
+	if check.Name == "" {
+		return fmt.Errorf("health - invalid check name")
+	}
+
+	if check.Func == nil {
+		return fmt.Errorf("health - nil func for check %s", check.Name)
+	}
+
+	if check.Timeout <= 0 {
+		check.Timeout = DefaultTimeout
+	}
+
+	if check.CacheTTL <= 0 {
+		check.CacheTTL = DefaultCacheTTL
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.entries {
+		if e.check.Name == check.Name {
+			return fmt.Errorf("health - multiple registrations for check %s", check.Name)
+		}
+	}
+
+	r.entries = append(r.entries, &entry{check: check})
+	return nil
+}
+
+// SetShuttingDown makes the readiness endpoint fail, so no new traffic is
+// routed to the service while it is shutting down.
+func (r *Registry) SetShuttingDown() {
+	atomic.StoreInt32(&r.shuttingDown, 1)
+}
+
+// ClearShuttingDown makes the readiness endpoint report the checks again, e.g. when
+// the service serves again after a shutdown.
+func (r *Registry) ClearShuttingDown() {
+	atomic.StoreInt32(&r.shuttingDown, 0)
+}
+
+// IsShuttingDown reports whether SetShuttingDown was called.
+func (r *Registry) IsShuttingDown() bool {
+	return atomic.LoadInt32(&r.shuttingDown) == 1
+}
+
+// Liveness runs the liveness checks.
+func (r *Registry) Liveness(ctx context.Context) Report {
+	return r.run(ctx, true)
+}
+
+// Readiness runs every check. It fails as soon as the service starts shutting down.
+func (r *Registry) Readiness(ctx context.Context) Report {
+	if r.IsShuttingDown() {
+		return Report{Status: StatusShuttingDown}
+	}
+
+	return r.run(ctx, false)
+}
+
+// LivenessHandler returns the http handler for the liveness endpoint.
+func (r *Registry) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.Liveness(req.Context()))
+	})
+}
+
+// ReadinessHandler returns the http handler for the readiness endpoint.
+func (r *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.Readiness(req.Context()))
+	})
+}
+
+func (r *Registry) run(ctx context.Context, livenessOnly bool) Report {
+	r.mu.RLock()
+	entries := make([]*entry, 0, len(r.entries))
+	for _, e := range r.entries {
+		if !livenessOnly || e.check.Liveness {
+			entries = append(entries, e)
+		}
+	}
+	r.mu.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(entries))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+
+			result := e.run(ctx)
+
+			mu.Lock()
+			report.Checks[e.check.Name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFail
+			}
+			mu.Unlock()
+		}(e)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// run returns the cached result or runs the check if it expired.
+func (e *entry) run(ctx context.Context) Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(e.expire) {
+		return e.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.check.Timeout)
+	defer cancel()
+
+	// The check runs in its own goroutine so the timeout is honored
+	// even if the check ignores the context.
+	done := make(chan error, 1)
+	go func() {
+		done <- e.check.Func(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("check timed out after %s", e.check.Timeout)
+	}
+
+	result := Result{
+		Status:    StatusOK,
+		Duration:  time.Since(now).String(),
+		CheckedAt: now,
+	}
+
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	e.result = result
+	e.expire = now.Add(e.check.CacheTTL)
+
+	return result
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	code := http.StatusOK
+	if report.Status != StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
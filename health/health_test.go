@@ -0,0 +1,121 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test duplicated check names
+func TestRegisterDuplication(t *testing.T) {
+	r := New()
+	check := Check{Name: "db", Func: func(ctx context.Context) error { return nil }}
+
+	if err := r.Register(check); err != nil {
+		t.Fatalf("Register - Expecting: nil; Got: %s", err)
+	}
+
+	if err := r.Register(check); err == nil {
+		t.Errorf("Register duplicated - Expecting: error; Got: nil")
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	r := New()
+	r.Register(Check{Name: "ok", Func: func(ctx context.Context) error { return nil }})
+	r.Register(Check{Name: "broken", Func: func(ctx context.Context) error { return errors.New("broken") }})
+
+	report := r.Readiness(context.Background())
+	if report.Status != StatusFail {
+		t.Errorf("Readiness - Expecting: %s; Got: %s", StatusFail, report.Status)
+	}
+
+	if report.Checks["ok"].Status != StatusOK {
+		t.Errorf("Check ok - Expecting: %s; Got: %s", StatusOK, report.Checks["ok"].Status)
+	}
+
+	if report.Checks["broken"].Error != "broken" {
+		t.Errorf("Check broken - Expecting: broken; Got: %s", report.Checks["broken"].Error)
+	}
+
+	// Liveness only runs the liveness checks
+	if report := r.Liveness(context.Background()); report.Status != StatusOK {
+		t.Errorf("Liveness - Expecting: %s; Got: %s", StatusOK, report.Status)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	r := New()
+	r.Register(Check{
+		Name:    "slow",
+		Timeout: 10 * time.Millisecond,
+		Func: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		},
+	})
+
+	start := time.Now()
+	report := r.Readiness(context.Background())
+
+	if report.Status != StatusFail {
+		t.Errorf("Timeout - Expecting: %s; Got: %s", StatusFail, report.Status)
+	}
+
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Timeout - Expecting the check to be cancelled; took %s", time.Since(start))
+	}
+}
+
+func TestCheckCache(t *testing.T) {
+	var calls int32
+
+	r := New()
+	r.Register(Check{
+		Name:     "cached",
+		CacheTTL: time.Minute,
+		Func: func(ctx context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		},
+	})
+
+	r.Readiness(context.Background())
+	r.Readiness(context.Background())
+
+	if calls != 1 {
+		t.Errorf("Cache - Expecting: 1 call; Got: %d", calls)
+	}
+}
+
+func TestReadinessShuttingDown(t *testing.T) {
+	r := New()
+	r.SetShuttingDown()
+
+	w := httptest.NewRecorder()
+	r.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Shutting down - Expecting: %d; Got: %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.LivenessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Liveness shutting down - Expecting: %d; Got: %d", http.StatusOK, w.Code)
+	}
+
+	r.ClearShuttingDown()
+
+	w = httptest.NewRecorder()
+	r.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Cleared - Expecting: %d; Got: %d", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,91 @@
+package gohan
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Headers carrying the ids of the request and of its trace between the services.
+const (
+	RequestIDHeader = "X-Request-Id"
+	TraceIDHeader   = "X-Trace-Id"
+)
+
+// maxTraceIDLength bounds the trace ids accepted from the callers, they end up in the logs.
+const maxTraceIDLength = 128
+
+type serviceContextKey struct{}
+
+// NewContext returns a copy of ctx carrying the service context. The requests sent
+// with ServiceContext.HttpClient carry it, so the transports can use its logger.
+func NewContext(ctx context.Context, sc *ServiceContext) context.Context {
+	return context.WithValue(ctx, serviceContextKey{}, sc)
+}
+
+// FromContext returns the service context carried by ctx, see NewContext.
+func FromContext(ctx context.Context) (*ServiceContext, bool) {
+	sc, ok := ctx.Value(serviceContextKey{}).(*ServiceContext)
+	return sc, ok
+}
+
+// incomingTraceID returns the trace id sent by the caller, or an empty string.
+func incomingTraceID(req *http.Request) string {
+	id := req.Header.Get(TraceIDHeader)
+	if len(id) > maxTraceIDLength {
+		return ""
+	}
+
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return ""
+		}
+	}
+
+	return id
+}
+
+// requestClient returns a copy of the service client for the request.
+func requestClient(client *http.Client, sc *ServiceContext) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	c := *client
+	c.Transport = &requestTransport{base: client.Transport, sc: sc}
+	return &c
+}
+
+// requestTransport sends the ids of the request and logs the calls with its logger.
+type requestTransport struct {
+	base http.RoundTripper
+	sc   *ServiceContext
+}
+
+func (t *requestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	req = req.Clone(NewContext(req.Context(), t.sc))
+	if req.Header.Get(RequestIDHeader) == "" && t.sc.RequestID != "" {
+		req.Header.Set(RequestIDHeader, t.sc.RequestID)
+	}
+	if req.Header.Get(TraceIDHeader) == "" && t.sc.TraceID != "" {
+		req.Header.Set(TraceIDHeader, t.sc.TraceID)
+	}
+
+	// the query may contain credentials
+	target := req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+
+	start := time.Now()
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		t.sc.Logger.Debugf("http client: %s %s failed after %s: %s", req.Method, target, time.Since(start), err)
+		return nil, err
+	}
+
+	t.sc.Logger.Debugf("http client: %s %s: %d in %s", req.Method, target, res.StatusCode, time.Since(start))
+	return res, nil
+}
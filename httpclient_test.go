@@ -0,0 +1,45 @@
+package gohan
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestClient(t *testing.T) {
+	var received http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received = req.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	s := newTestService(t)
+
+	var requestID, traceID string
+	s.GET("/proxy", func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		requestID, traceID = sc.RequestID, sc.TraceID
+
+		res, err := sc.HttpClient.Get(upstream.URL)
+		if err != nil {
+			t.Errorf("Get - Expecting: nil; Got: %s", err)
+			return
+		}
+		res.Body.Close()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/proxy", nil)
+	req.Header.Set(TraceIDHeader, "trace-1")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	if requestID == "" || received.Get(RequestIDHeader) != requestID {
+		t.Errorf("%s - Expecting: %q; Got: %q", RequestIDHeader, requestID, received.Get(RequestIDHeader))
+	}
+
+	if traceID != "trace-1" || received.Get(TraceIDHeader) != "trace-1" {
+		t.Errorf("%s - Expecting: trace-1; Got: %q %q", TraceIDHeader, traceID, received.Get(TraceIDHeader))
+	}
+
+	if s.HttpClient.Transport != nil {
+		t.Errorf("Service client - Expecting: unchanged; Got: %T", s.HttpClient.Transport)
+	}
+}
@@ -0,0 +1,241 @@
+// Package idempotency contains a middleware making the retries of a request safe, using
+// the Idempotency-Key header sent by the clients:
+//
+//	store := idempotency.NewSQLStore(db, "")
+//	service.POST("/orders", createOrder, idempotency.New(idempotency.Config{Store: store}))
+//
+// The first response of a key is recorded and replayed for the retries, with the
+// Idempotent-Replayed header. A retry sent while the first request is in progress gets
+// a 409 problem response, a key reused with a different request gets a 422.
+// Server errors (5xx), large and streamed responses aren't recorded, so the request can
+// be retried.
+//
+// The keys are scoped by user (ServiceContext.LoggedUserIdentifier), the middleware
+// should come after the authentication. The stores receive the hash of the scoped key,
+// 64 hexadecimal characters.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/internal/record"
+	"github.com/appnaconda/gohan/logger"
+	"github.com/appnaconda/gohan/response"
+)
+
+// Default values of the configuration.
+const (
+	DefaultHeader       = "Idempotency-Key"
+	DefaultTTL          = 24 * time.Hour
+	DefaultLockTimeout  = time.Minute
+	DefaultMaxBodyBytes = 1 << 20
+	MaxKeyLength        = 255
+)
+
+// ReplayedHeader is set on the replayed responses.
+const ReplayedHeader = "Idempotent-Replayed"
+
+// DefaultMethods are the methods using the keys when none are configured.
+var DefaultMethods = []string{http.MethodPost, http.MethodPatch}
+
+// Config contains the settings of the middleware.
+type Config struct {
+	// Where the keys and the responses are stored, e.g. a SQLStore using the service
+	// database.
+	Store Store
+
+	// Header containing the key. Defaults to DefaultHeader.
+	Header string
+
+	// Methods using the keys. Defaults to DefaultMethods.
+	Methods []string
+
+	// How long the responses are replayed. Defaults to DefaultTTL.
+	TTL time.Duration
+
+	// How long a key stays locked by a request in progress, in case the instance
+	// stops before recording the response. It should be longer than the handler.
+	// Defaults to DefaultLockTimeout.
+	LockTimeout time.Duration
+
+	// Rejects the requests without key with a 400 problem response.
+	Required bool
+
+	// Responses larger than MaxBodyBytes or flushed by the handler aren't recorded, the
+	// key is released so the request can be retried. Defaults to DefaultMaxBodyBytes.
+	MaxBodyBytes int
+
+	// used by the tests
+	now func() time.Time
+}
+
+// New returns the idempotency middleware.
+func New(config Config) gohan.MiddlewareFunc {
+	if config.Store == nil {
+		panic("idempotency - no store was provided")
+	}
+
+	if config.Header == "" {
+		config.Header = DefaultHeader
+	}
+
+	if len(config.Methods) == 0 {
+		config.Methods = DefaultMethods
+	}
+
+	if config.TTL <= 0 {
+		config.TTL = DefaultTTL
+	}
+
+	if config.LockTimeout <= 0 {
+		config.LockTimeout = DefaultLockTimeout
+	}
+
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+
+	if config.now == nil {
+		config.now = time.Now
+	}
+
+	methods := make(map[string]bool)
+	for _, method := range config.Methods {
+		methods[method] = true
+	}
+
+	return func(next gohan.HandlerFunc) gohan.HandlerFunc {
+		return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+			if !methods[req.Method] {
+				next(sc, w, req)
+				return
+			}
+
+			key := req.Header.Get(config.Header)
+			if key == "" {
+				if config.Required {
+					response.Problem(w, http.StatusBadRequest, "missing "+config.Header+" header")
+					return
+				}
+
+				next(sc, w, req)
+				return
+			}
+
+			if len(key) > MaxKeyLength {
+				response.Problem(w, http.StatusBadRequest, "invalid "+config.Header+" header")
+				return
+			}
+
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					response.Problem(w, http.StatusRequestEntityTooLarge, "the request body is too large")
+					return
+				}
+
+				sc.Logger.Infof("failed reading the request body: %s", err)
+				response.Problem(w, http.StatusBadRequest, "failed reading the request body")
+				return
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			sc.Logger = sc.Logger.With(logger.Fields{"idempotency_key": key})
+			key = scopedKey(sc.LoggedUserIdentifier, key)
+			fingerprint := Fingerprint(req, body)
+
+			existing, err := config.Store.Lock(req.Context(), key, fingerprint, config.now().Add(config.LockTimeout))
+			if err != nil {
+				sc.Logger.Errorf("failed locking the idempotency key: %+v", err)
+				response.Problem(w, http.StatusServiceUnavailable, "failed checking the idempotency key")
+				return
+			}
+
+			if existing != nil {
+				switch {
+				case existing.Fingerprint != fingerprint:
+					sc.Logger.Infof("idempotency key reused with a different request")
+					response.Problem(w, http.StatusUnprocessableEntity, "the idempotency key was used with a different request")
+
+				case !existing.Completed:
+					sc.Logger.Infof("idempotency key in use by a request in progress")
+					w.Header().Set("Retry-After", "1")
+					response.Problem(w, http.StatusConflict, "a request with the same idempotency key is in progress")
+
+				default:
+					sc.Logger.Debugf("replaying the response of the idempotency key")
+					replay(w, existing)
+				}
+				return
+			}
+
+			// The key is released or saved even if the client is gone
+			ctx := context.WithoutCancel(req.Context())
+			rw := record.NewWriter(w, config.MaxBodyBytes)
+
+			completed := false
+			defer func() {
+				if !completed || rw.Status() >= http.StatusInternalServerError || rw.TooLarge() || rw.Streamed() {
+					if err := config.Store.Unlock(ctx, key); err != nil {
+						sc.Logger.Errorf("failed unlocking the idempotency key: %+v", err)
+					}
+					return
+				}
+
+				saved := &Record{
+					Fingerprint: fingerprint,
+					Completed:   true,
+					Status:      rw.Status(),
+					Header:      rw.Header(),
+					Body:        rw.Body(),
+				}
+				if err := config.Store.Save(ctx, key, saved, config.now().Add(config.TTL)); err != nil {
+					sc.Logger.Errorf("failed saving the response of the idempotency key: %+v", err)
+				}
+			}()
+
+			next(sc, rw, req)
+			rw.Close()
+			completed = true
+		}
+	}
+}
+
+// Fingerprint returns the hash identifying the request with the key: method, path,
+// query and body.
+func Fingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// scopedKey returns the hash of the key of the user, so its length is fixed whatever
+// the length of the user identifier.
+func scopedKey(user, key string) string {
+	h := sha256.New()
+	h.Write([]byte(user))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, record *Record) {
+	h := w.Header()
+	for name, values := range record.Header {
+		h[name] = append([]string(nil), values...)
+	}
+	h.Set(ReplayedHeader, "true")
+
+	w.WriteHeader(record.Status)
+	w.Write(record.Body)
+}
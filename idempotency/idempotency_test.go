@@ -0,0 +1,232 @@
+package idempotency
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/internal/gohantest"
+)
+
+func newTestService(t *testing.T, config Config) (*gohan.Service, *int32) {
+	t.Helper()
+
+	s := gohantest.NewService(t)
+
+	calls := new(int32)
+	s.POST("/orders", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+		body, _ := ioutil.ReadAll(req.Body)
+
+		if string(body) == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/orders/%d", n))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "order %d: %s", n, body)
+	}, New(config), func(next gohan.HandlerFunc) gohan.HandlerFunc {
+		return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+			sc.LoggedUserIdentifier = req.Header.Get("X-User")
+			next(sc, w, req)
+		}
+	})
+
+	return s, calls
+}
+
+func post(s *gohan.Service, key, user, body string) *httptest.ResponseRecorder {
+	req := gohantest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body), map[string]string{"X-User": user})
+	if key != "" {
+		req.Header.Set(DefaultHeader, key)
+	}
+
+	return gohantest.Serve(s, req)
+}
+
+func TestReplay(t *testing.T) {
+	s, calls := newTestService(t, Config{Store: NewMemoryStore()})
+
+	first := post(s, "key-1", "alice", "pizza")
+	if first.Code != http.StatusCreated || first.Body.String() != "order 1: pizza" {
+		t.Fatalf("First - Expecting: 201 order 1; Got: %d %s", first.Code, first.Body.String())
+	}
+
+	retry := post(s, "key-1", "alice", "pizza")
+	if retry.Code != http.StatusCreated || retry.Body.String() != "order 1: pizza" {
+		t.Errorf("Retry - Expecting: 201 order 1; Got: %d %s", retry.Code, retry.Body.String())
+	}
+
+	if location := retry.Header().Get("Location"); location != "/orders/1" {
+		t.Errorf("Retry - Expecting: Location /orders/1; Got: %s", location)
+	}
+
+	if retry.Header().Get(ReplayedHeader) != "true" || first.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("%s - Expecting: only on the retry; Got: %q %q", ReplayedHeader, first.Header().Get(ReplayedHeader), retry.Header().Get(ReplayedHeader))
+	}
+
+	// the keys are scoped by user, requests without key aren't deduplicated
+	post(s, "key-1", "bob", "pizza")
+	post(s, "", "alice", "pizza")
+	post(s, "", "alice", "pizza")
+
+	if *calls != 4 {
+		t.Errorf("Calls - Expecting: 4; Got: %d", *calls)
+	}
+}
+
+func TestPayloadMismatch(t *testing.T) {
+	s, calls := newTestService(t, Config{Store: NewMemoryStore()})
+
+	post(s, "key-1", "alice", "pizza")
+	if w := post(s, "key-1", "alice", "sushi"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Different body - Expecting: 422; Got: %d", w.Code)
+	}
+
+	if *calls != 1 {
+		t.Errorf("Calls - Expecting: 1; Got: %d", *calls)
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	store := NewMemoryStore()
+	s, _ := newTestService(t, Config{Store: store})
+
+	release := make(chan struct{})
+	locked := make(chan struct{})
+	s.POST("/slow", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		close(locked)
+		<-release
+		w.Write([]byte("done"))
+	}, New(Config{Store: store}))
+
+	slow := func() *httptest.ResponseRecorder {
+		req := gohantest.NewRequest(http.MethodPost, "/slow", strings.NewReader("{}"), map[string]string{DefaultHeader: "key-1"})
+		return gohantest.Serve(s, req)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		slow()
+	}()
+
+	<-locked
+	if w := slow(); w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+		t.Errorf("In progress - Expecting: 409 with Retry-After; Got: %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	wg.Wait()
+
+	if w := slow(); w.Code != http.StatusOK || w.Body.String() != "done" {
+		t.Errorf("Completed - Expecting: 200 done; Got: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestServerErrorUnlocks(t *testing.T) {
+	store := NewMemoryStore()
+	s, calls := newTestService(t, Config{Store: store})
+
+	post(s, "key-1", "alice", "fail")
+	post(s, "key-1", "alice", "fail")
+
+	if *calls != 2 {
+		t.Errorf("Calls - Expecting: 2; Got: %d", *calls)
+	}
+
+	if store.Len() != 0 {
+		t.Errorf("Store - Expecting: no keys; Got: %d", store.Len())
+	}
+}
+
+func TestLargeResponseUnlocks(t *testing.T) {
+	store := NewMemoryStore()
+	s, calls := newTestService(t, Config{Store: store, MaxBodyBytes: 10})
+
+	// "order 1: pizza" is larger than MaxBodyBytes
+	post(s, "key-1", "alice", "pizza")
+	if w := post(s, "key-1", "alice", "pizza"); w.Body.String() != "order 2: pizza" {
+		t.Errorf("Retry - Expecting: order 2: pizza; Got: %s", w.Body.String())
+	}
+
+	if *calls != 2 || store.Len() != 0 {
+		t.Errorf("Large response - Expecting: 2 calls and no keys; Got: %d calls, %d keys", *calls, store.Len())
+	}
+}
+
+func TestStreamedResponseUnlocks(t *testing.T) {
+	store := NewMemoryStore()
+	s, _ := newTestService(t, Config{Store: store})
+
+	var calls int
+	s.POST("/events", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.Write([]byte("event"))
+		w.(http.Flusher).Flush()
+	}, New(Config{Store: store}))
+
+	for i := 0; i < 2; i++ {
+		gohantest.Do(s, http.MethodPost, "/events", map[string]string{DefaultHeader: "key-1"})
+	}
+
+	if calls != 2 || store.Len() != 0 {
+		t.Errorf("Streamed response - Expecting: 2 calls and no keys; Got: %d calls, %d keys", calls, store.Len())
+	}
+}
+
+func TestRequired(t *testing.T) {
+	s, calls := newTestService(t, Config{Store: NewMemoryStore(), Required: true})
+
+	if w := post(s, "", "alice", "pizza"); w.Code != http.StatusBadRequest {
+		t.Errorf("Missing key - Expecting: 400; Got: %d", w.Code)
+	}
+
+	if w := post(s, strings.Repeat("k", MaxKeyLength+1), "alice", "pizza"); w.Code != http.StatusBadRequest {
+		t.Errorf("Long key - Expecting: 400; Got: %d", w.Code)
+	}
+
+	if *calls != 0 {
+		t.Errorf("Calls - Expecting: 0; Got: %d", *calls)
+	}
+}
+
+func TestHeadersOnly(t *testing.T) {
+	s := gohantest.NewService(t)
+
+	s.POST("/orders", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Location", "/orders/1")
+	}, New(Config{Store: NewMemoryStore()}))
+
+	for _, name := range []string{"First", "Retry"} {
+		req := gohantest.NewRequest(http.MethodPost, "/orders", strings.NewReader("pizza"), map[string]string{DefaultHeader: "key-1"})
+		w := gohantest.Serve(s, req)
+		if w.Code != http.StatusOK || w.Header().Get("Location") != "/orders/1" {
+			t.Errorf("%s - Expecting: 200 Location /orders/1; Got: %d %v", name, w.Code, w.Header())
+		}
+	}
+}
+
+func TestKeyLength(t *testing.T) {
+	store := NewMemoryStore()
+	s, _ := newTestService(t, Config{Store: store})
+
+	if w := post(s, strings.Repeat("k", MaxKeyLength), strings.Repeat("u", 100), "pizza"); w.Code != http.StatusCreated {
+		t.Fatalf("Longest key - Expecting: 201; Got: %d", w.Code)
+	}
+
+	// the scoped keys fit the id column of the SQLStore
+	for key := range store.keys {
+		if len(key) != 64 {
+			t.Errorf("Stored key - Expecting: 64 characters; Got: %d", len(key))
+		}
+	}
+}
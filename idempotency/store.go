@@ -0,0 +1,210 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Record is the state of an idempotency key: the request in progress or its response.
+type Record struct {
+	// Hash of the method, path and body of the request.
+	Fingerprint string
+
+	// The response is recorded, otherwise the request is in progress.
+	Completed bool
+
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Store keeps the idempotency keys. Implementations must be safe for concurrent use.
+type Store interface {
+	// Lock reserves the key for a request in progress until expiresAt. If the key exists,
+	// it returns its record and leaves it unchanged, otherwise it returns nil.
+	Lock(ctx context.Context, key, fingerprint string, expiresAt time.Time) (*Record, error)
+
+	// Save records the response of the request holding the key until expiresAt.
+	Save(ctx context.Context, key string, record *Record, expiresAt time.Time) error
+
+	// Unlock removes the key, so the request can be retried.
+	Unlock(ctx context.Context, key string) error
+}
+
+type memoryEntry struct {
+	record    Record
+	expiresAt time.Time
+}
+
+// MemoryStore keeps the keys in memory, they are lost on restart and aren't shared
+// between instances. The expired keys are evicted.
+type MemoryStore struct {
+	mu        sync.Mutex
+	keys      map[string]memoryEntry
+	lastSweep time.Time
+
+	// used by the tests
+	now func() time.Time
+}
+
+// DefaultSweepInterval is how often the memory store evicts the expired keys.
+const DefaultSweepInterval = time.Minute
+
+// NewMemoryStore returns an empty memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]memoryEntry), now: time.Now}
+}
+
+// Lock implements the Store interface.
+func (m *MemoryStore) Lock(ctx context.Context, key, fingerprint string, expiresAt time.Time) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= DefaultSweepInterval {
+		m.lastSweep = now
+		for key, entry := range m.keys {
+			if !now.Before(entry.expiresAt) {
+				delete(m.keys, key)
+			}
+		}
+	}
+
+	if entry, ok := m.keys[key]; ok && now.Before(entry.expiresAt) {
+		record := entry.record
+		return &record, nil
+	}
+
+	m.keys[key] = memoryEntry{record: Record{Fingerprint: fingerprint}, expiresAt: expiresAt}
+	return nil, nil
+}
+
+// Save implements the Store interface.
+func (m *MemoryStore) Save(ctx context.Context, key string, record *Record, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys[key] = memoryEntry{record: *record, expiresAt: expiresAt}
+	return nil
+}
+
+// Unlock implements the Store interface.
+func (m *MemoryStore) Unlock(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.keys, key)
+	return nil
+}
+
+// Len returns the number of keys in the store.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.keys)
+}
+
+// DefaultTable is the table used by the SQL store when none is configured.
+const DefaultTable = "idempotency_keys"
+
+// SQLStore keeps the keys in a table of the service database (MySQL):
+//
+//	CREATE TABLE idempotency_keys (
+//		id          VARCHAR(255) NOT NULL PRIMARY KEY,
+//		fingerprint CHAR(64)     NOT NULL,
+//		completed   BOOLEAN      NOT NULL DEFAULT FALSE,
+//		status      INT          NOT NULL DEFAULT 0,
+//		header      BLOB,
+//		body        MEDIUMBLOB,
+//		expires_at  DATETIME     NOT NULL,
+//		INDEX (expires_at)
+//	);
+//
+// The expired keys are replaced when locked again, see DeleteExpired to remove them.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLStore returns a store using the table. An empty table uses DefaultTable.
+func NewSQLStore(db *sql.DB, table string) *SQLStore {
+	if table == "" {
+		table = DefaultTable
+	}
+
+	return &SQLStore{db: db, table: table}
+}
+
+// Lock implements the Store interface.
+func (s *SQLStore) Lock(ctx context.Context, key, fingerprint string, expiresAt time.Time) (*Record, error) {
+	now := time.Now().UTC()
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM "+s.table+" WHERE id = ? AND expires_at <= ?", key, now); err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.ExecContext(ctx, "INSERT IGNORE INTO "+s.table+" (id, fingerprint, expires_at) VALUES (?, ?, ?)",
+		key, fingerprint, expiresAt.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	if n, err := result.RowsAffected(); err != nil || n == 1 {
+		return nil, err
+	}
+
+	var (
+		record Record
+		header []byte
+	)
+
+	err = s.db.QueryRowContext(ctx, "SELECT fingerprint, completed, status, header, body FROM "+s.table+" WHERE id = ?", key).
+		Scan(&record.Fingerprint, &record.Completed, &record.Status, &header, &record.Body)
+	if err == sql.ErrNoRows {
+		// removed in the meantime, e.g. unlocked after a failure
+		return s.Lock(ctx, key, fingerprint, expiresAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(header) > 0 {
+		if err := json.Unmarshal(header, &record.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return &record, nil
+}
+
+// Save implements the Store interface.
+func (s *SQLStore) Save(ctx context.Context, key string, record *Record, expiresAt time.Time) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, "UPDATE "+s.table+" SET completed = ?, status = ?, header = ?, body = ?, expires_at = ? WHERE id = ?",
+		record.Completed, record.Status, header, record.Body, expiresAt.UTC(), key)
+	return err
+}
+
+// Unlock implements the Store interface.
+func (s *SQLStore) Unlock(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM "+s.table+" WHERE id = ?", key)
+	return err
+}
+
+// DeleteExpired removes the expired keys, e.g. from a background worker (see Service.Go).
+func (s *SQLStore) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM "+s.table+" WHERE expires_at <= ?", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
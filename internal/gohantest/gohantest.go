@@ -0,0 +1,56 @@
+// Package gohantest contains the helpers shared by the tests of the middleware
+// packages: a service discarding its logs and the requests sent to it.
+package gohantest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appnaconda/gohan"
+)
+
+// NewService returns a service discarding its logs, the test fails if it can't be
+// created.
+func NewService(t testing.TB) *gohan.Service {
+	t.Helper()
+
+	s, err := gohan.New(context.Background())
+	if err != nil {
+		t.Fatalf("New - Expecting: nil; Got: %s", err)
+	}
+
+	s.Logger.SetOutput(ioutil.Discard)
+
+	return s
+}
+
+// NewRequest returns a request with the headers.
+func NewRequest(method, target string, body io.Reader, headers map[string]string) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	return req
+}
+
+// Serve sends the request to the handler and returns the recorded response.
+func Serve(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// Do sends a request with the headers and returns the recorded response.
+func Do(h http.Handler, method, target string, headers map[string]string) *httptest.ResponseRecorder {
+	return Serve(h, NewRequest(method, target, nil, headers))
+}
+
+// Get sends a GET request with the headers and returns the recorded response.
+func Get(h http.Handler, target string, headers map[string]string) *httptest.ResponseRecorder {
+	return Do(h, http.MethodGet, target, headers)
+}
@@ -0,0 +1,117 @@
+// Package record contains the http.ResponseWriter recording the responses for the
+// cache and idempotency middlewares.
+package record
+
+import "net/http"
+
+// Writer writes the response and records it. The handler has its own headers so the
+// ones set by the outer middlewares aren't recorded.
+type Writer struct {
+	http.ResponseWriter
+
+	header   http.Header
+	maxBytes int
+
+	status      int
+	wroteHeader bool
+	body        []byte
+	tooLarge    bool
+	streamed    bool
+}
+
+// NewWriter returns a writer recording up to maxBytes of body, a zero maxBytes means
+// no limit.
+func NewWriter(w http.ResponseWriter, maxBytes int) *Writer {
+	return &Writer{ResponseWriter: w, header: make(http.Header), maxBytes: maxBytes}
+}
+
+// Header returns the headers of the handler, they are copied to the original writer
+// with the status.
+func (w *Writer) Header() http.Header {
+	return w.header
+}
+
+func (w *Writer) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+
+	if code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.status = code
+	w.wroteHeader = true
+
+	dst := w.ResponseWriter.Header()
+	for name, values := range w.header {
+		dst[name] = values
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *Writer) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !w.tooLarge {
+		if w.maxBytes > 0 && len(w.body)+len(b) > w.maxBytes {
+			w.tooLarge = true
+			w.body = nil
+		} else {
+			w.body = append(w.body, b...)
+		}
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends the response written so far.
+func (w *Writer) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	w.streamed = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original writer, see http.ResponseController.
+func (w *Writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close sends the headers of the handlers returning without writing anything, it must
+// be called once the handler returned.
+func (w *Writer) Close() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// Status returns the status of the response, handlers not writing anything send a 200.
+func (w *Writer) Status() int {
+	if !w.wroteHeader {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Body returns the recorded body, nil if it's larger than maxBytes.
+func (w *Writer) Body() []byte {
+	return w.body
+}
+
+// TooLarge reports if the body is larger than maxBytes.
+func (w *Writer) TooLarge() bool {
+	return w.tooLarge
+}
+
+// Streamed reports if the handler flushed the response.
+func (w *Writer) Streamed() bool {
+	return w.streamed
+}
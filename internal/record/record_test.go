@@ -0,0 +1,47 @@
+package record
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("X-Outer", "true")
+
+	w := NewWriter(rec, 5)
+	w.Header().Set("X-Handler", "true")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("hello"))
+
+	if rec.Code != http.StatusCreated || rec.Body.String() != "hello" || rec.Header().Get("X-Handler") != "true" {
+		t.Errorf("Response - Expecting: 201 hello X-Handler; Got: %d %s %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+
+	if w.Status() != http.StatusCreated || string(w.Body()) != "hello" || w.Header().Get("X-Outer") != "" {
+		t.Errorf("Record - Expecting: 201 hello without X-Outer; Got: %d %s %v", w.Status(), w.Body(), w.Header())
+	}
+
+	w.Write([]byte("!"))
+	if !w.TooLarge() || w.Body() != nil {
+		t.Errorf("Too large - Expecting: no body; Got: %s", w.Body())
+	}
+}
+
+func TestClose(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	// the handler only sets headers
+	w := NewWriter(rec, 0)
+	w.Header().Set("Location", "/orders/1")
+	w.Close()
+
+	if rec.Header().Get("Location") != "/orders/1" {
+		t.Errorf("Headers - Expecting: Location /orders/1; Got: %v", rec.Header())
+	}
+
+	if w.Status() != http.StatusOK {
+		t.Errorf("Status - Expecting: 200; Got: %d", w.Status())
+	}
+}
@@ -0,0 +1,211 @@
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultJWKSRefreshInterval is how often the JWKS file is checked for changes.
+const DefaultJWKSRefreshInterval = time.Minute
+
+// Key is a verification key. The key id is matched against the kid header of the
+// tokens, a key without id is used for any token.
+type Key struct {
+	ID string
+
+	// []byte for HS256, *rsa.PublicKey for RS256 and *ecdsa.PublicKey for ES256.
+	Key interface{}
+}
+
+// KeySet returns the keys used to verify the tokens.
+type KeySet interface {
+	Keys() ([]Key, error)
+}
+
+// StaticKeys is a fixed set of keys.
+type StaticKeys []Key
+
+// Keys implements the KeySet interface.
+func (k StaticKeys) Keys() ([]Key, error) {
+	return k, nil
+}
+
+// jwk is a JSON Web Key (RFC 7517). Only the fields needed for HS256, RS256 and ES256 are read.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// JWKSFile is a key set read from a local JWKS file. The file is read again when it
+// changes, it's checked at most once per refresh interval.
+type JWKSFile struct {
+	path     string
+	interval time.Duration
+
+	mu        sync.Mutex
+	keys      []Key
+	modTime   time.Time
+	lastCheck time.Time
+
+	// used by the tests
+	now func() time.Time
+}
+
+// NewJWKSFile reads the JWKS file. A zero interval uses DefaultJWKSRefreshInterval.
+func NewJWKSFile(path string, interval time.Duration) (*JWKSFile, error) {
+	if interval <= 0 {
+		interval = DefaultJWKSRefreshInterval
+	}
+
+	f := &JWKSFile{path: path, interval: interval, now: time.Now}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Keys implements the KeySet interface. When the file can't be read again, the
+// previous keys are kept.
+func (f *JWKSFile) Keys() ([]Key, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	if now.Sub(f.lastCheck) >= f.interval {
+		f.lastCheck = now
+
+		if info, err := os.Stat(f.path); err == nil && !info.ModTime().Equal(f.modTime) {
+			if err := f.load(); err != nil {
+				return f.keys, fmt.Errorf("failed reloading the JWKS file %s: %w", f.path, err)
+			}
+		}
+	}
+
+	return f.keys, nil
+}
+
+// Reload reads the file again.
+func (f *JWKSFile) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lastCheck = f.now()
+	return f.load()
+}
+
+// load reads the file. The lock must be held.
+func (f *JWKSFile) load() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	f.keys = keys
+	f.modTime = info.ModTime()
+	return nil
+}
+
+// ParseJWKS parses a JSON Web Key Set. The keys with an unsupported type or not used
+// for signatures are skipped.
+func ParseJWKS(data []byte) ([]Key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make([]Key, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.key()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", k.Kid, err)
+		}
+
+		if key != nil {
+			keys = append(keys, Key{ID: k.Kid, Key: key})
+		}
+	}
+
+	return keys, nil
+}
+
+func (k jwk) key() (interface{}, error) {
+	switch k.Kty {
+	case "oct":
+		return decode(k.K)
+
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+func decode(s string) ([]byte, error) {
+	if s == "" {
+		return nil, fmt.Errorf("missing key parameter")
+	}
+
+	return base64.RawURLEncoding.DecodeString(s)
+}
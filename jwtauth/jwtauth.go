@@ -0,0 +1,217 @@
+// Package jwtauth contains a middleware authenticating the requests with JWT bearer tokens.
+//
+//	keys, err := jwtauth.NewJWKSFile("/etc/service/jwks.json", time.Minute)
+//	...
+//	auth, err := jwtauth.New(jwtauth.Config{
+//		Keys:     keys,
+//		Issuer:   "https://auth.example.com",
+//		Audience: "orders",
+//	})
+//	...
+//	service.Use(auth)
+//
+// The user id and the claims of the token are available in ServiceContext.LoggedUserIdentifier
+// and ServiceContext.Claims, the user id is also added to the request logger fields.
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/logger"
+	"github.com/appnaconda/gohan/response"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// Default values of the configuration.
+const (
+	DefaultUserClaim = "sub"
+	DefaultLeeway    = 30 * time.Second
+)
+
+// Config contains the settings of the middleware.
+type Config struct {
+	// Keys used to verify the tokens, see StaticKeys and JWKSFile.
+	Keys KeySet
+
+	// Accepted signing algorithms. Defaults to HS256, RS256 and ES256.
+	Algorithms []string
+
+	// Expected iss and aud claims, they aren't checked when empty.
+	Issuer   string
+	Audience string
+
+	// Clock skew tolerated when checking the exp and nbf claims. Defaults to DefaultLeeway,
+	// a negative value disables it.
+	Leeway time.Duration
+
+	// Claim containing the user id. Defaults to DefaultUserClaim.
+	UserClaim string
+
+	// Lets the requests without token through unauthenticated. Requests with an
+	// invalid token are still rejected.
+	Optional bool
+
+	// used by the tests
+	now func() time.Time
+}
+
+// New returns a middleware rejecting the requests without a valid bearer token with a 401
+// problem response.
+func New(config Config) (gohan.MiddlewareFunc, error) {
+	if config.Keys == nil {
+		return nil, fmt.Errorf("jwtauth - no keys were provided")
+	}
+
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = []string{HS256, RS256, ES256}
+	}
+
+	for _, alg := range config.Algorithms {
+		if alg != HS256 && alg != RS256 && alg != ES256 {
+			return nil, fmt.Errorf("jwtauth - unsupported algorithm %s", alg)
+		}
+	}
+
+	if config.Leeway == 0 {
+		config.Leeway = DefaultLeeway
+	} else if config.Leeway < 0 {
+		config.Leeway = 0
+	}
+
+	if config.UserClaim == "" {
+		config.UserClaim = DefaultUserClaim
+	}
+
+	if config.now == nil {
+		config.now = time.Now
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(config.Algorithms),
+		jwt.WithLeeway(config.Leeway),
+		jwt.WithTimeFunc(config.now),
+	}
+
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+
+	parser := jwt.NewParser(options...)
+
+	return func(next gohan.HandlerFunc) gohan.HandlerFunc {
+		return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+			token, ok := BearerToken(req)
+			if !ok {
+				if config.Optional {
+					next(sc, w, req)
+					return
+				}
+
+				unauthorized(w, "", "missing bearer token")
+				return
+			}
+
+			claims := jwt.MapClaims{}
+			if _, err := parser.ParseWithClaims(token, claims, config.keyFunc(sc)); err != nil {
+				sc.Logger.Infof("invalid bearer token: %s", err)
+				unauthorized(w, "invalid_token", "invalid bearer token")
+				return
+			}
+
+			user, _ := claims[config.UserClaim].(string)
+			if user == "" {
+				sc.Logger.Infof("invalid bearer token: missing %s claim", config.UserClaim)
+				unauthorized(w, "invalid_token", "invalid bearer token")
+				return
+			}
+
+			sc.LoggedUserIdentifier = user
+			sc.Claims = claims
+			sc.Logger = sc.Logger.With(logger.Fields{"user_id": user})
+
+			next(sc, w, req)
+		}
+	}, nil
+}
+
+// keyFunc returns the keys matching the kid and the algorithm of the token.
+func (c Config) keyFunc(sc *gohan.ServiceContext) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		keys, err := c.Keys.Keys()
+		if err != nil {
+			// the previous keys are still usable
+			sc.Logger.Errorf("failed loading the jwt keys: %+v", err)
+		}
+
+		kid, _ := token.Header["kid"].(string)
+
+		set := jwt.VerificationKeySet{}
+		for _, key := range keys {
+			if kid != "" && key.ID != "" && key.ID != kid {
+				continue
+			}
+
+			if matchesAlgorithm(key.Key, token.Method.Alg()) {
+				set.Keys = append(set.Keys, key.Key)
+			}
+		}
+
+		if len(set.Keys) == 0 {
+			return nil, errors.New("no matching key")
+		}
+
+		return set, nil
+	}
+}
+
+func matchesAlgorithm(key interface{}, alg string) bool {
+	switch key.(type) {
+	case []byte:
+		return alg == HS256
+	case *rsa.PublicKey:
+		return alg == RS256
+	case *ecdsa.PublicKey:
+		return alg == ES256
+	default:
+		return false
+	}
+}
+
+// BearerToken returns the token of the Authorization header.
+func BearerToken(req *http.Request) (string, bool) {
+	auth := req.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(auth[7:])
+	return token, token != ""
+}
+
+func unauthorized(w http.ResponseWriter, code, detail string) {
+	challenge := "Bearer"
+	if code != "" {
+		challenge += fmt.Sprintf(` error="%s"`, code)
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	response.Problem(w, http.StatusUnauthorized, detail)
+}
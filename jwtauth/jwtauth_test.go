@@ -0,0 +1,195 @@
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/internal/gohantest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var secret = []byte("secret")
+
+func newTestService(t *testing.T, config Config) *gohan.Service {
+	t.Helper()
+
+	s := gohantest.NewService(t)
+
+	auth, err := New(config)
+	if err != nil {
+		t.Fatalf("New auth - Expecting: nil; Got: %s", err)
+	}
+
+	s.GET("/", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "%s %v", sc.LoggedUserIdentifier, sc.Claims["role"])
+	}, auth)
+
+	return s
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Sign - Expecting: nil; Got: %s", err)
+	}
+
+	return signed
+}
+
+func get(s *gohan.Service, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return gohantest.Serve(s, req)
+}
+
+func TestMiddleware(t *testing.T) {
+	s := newTestService(t, Config{
+		Keys:     StaticKeys{{Key: secret}},
+		Issuer:   "issuer",
+		Audience: "service",
+	})
+
+	now := time.Now()
+	claims := func(changes jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"sub": "user", "role": "admin", "iss": "issuer", "aud": "service", "exp": now.Add(time.Minute).Unix()}
+		for k, v := range changes {
+			c[k] = v
+		}
+		return c
+	}
+
+	w := get(s, sign(t, jwt.SigningMethodHS256, "", secret, claims(nil)))
+	if w.Code != http.StatusOK || w.Body.String() != "user admin" {
+		t.Errorf("Valid token - Expecting: 200 user admin; Got: %d %s", w.Code, w.Body.String())
+	}
+
+	// Expired, but in the leeway
+	w = get(s, sign(t, jwt.SigningMethodHS256, "", secret, claims(jwt.MapClaims{"exp": now.Add(-10 * time.Second).Unix()})))
+	if w.Code != http.StatusOK {
+		t.Errorf("Leeway - Expecting: 200; Got: %d", w.Code)
+	}
+
+	invalid := map[string]string{
+		"missing":   "",
+		"expired":   sign(t, jwt.SigningMethodHS256, "", secret, claims(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()})),
+		"not yet":   sign(t, jwt.SigningMethodHS256, "", secret, claims(jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()})),
+		"issuer":    sign(t, jwt.SigningMethodHS256, "", secret, claims(jwt.MapClaims{"iss": "other"})),
+		"audience":  sign(t, jwt.SigningMethodHS256, "", secret, claims(jwt.MapClaims{"aud": "other"})),
+		"signature": sign(t, jwt.SigningMethodHS256, "", []byte("other"), claims(nil)),
+		"no user":   sign(t, jwt.SigningMethodHS256, "", secret, claims(jwt.MapClaims{"sub": ""})),
+		"algorithm": sign(t, jwt.SigningMethodHS384, "", secret, claims(nil)),
+	}
+
+	for name, token := range invalid {
+		w := get(s, token)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s - Expecting: 401; Got: %d", name, w.Code)
+		}
+
+		if w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s - Expecting: WWW-Authenticate header", name)
+		}
+	}
+}
+
+func TestMiddlewareOptional(t *testing.T) {
+	s := newTestService(t, Config{Keys: StaticKeys{{Key: secret}}, Optional: true})
+
+	if w := get(s, ""); w.Code != http.StatusOK {
+		t.Errorf("No token - Expecting: 200; Got: %d", w.Code)
+	}
+
+	if w := get(s, "invalid"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Invalid token - Expecting: 401; Got: %d", w.Code)
+	}
+}
+
+func TestMiddlewareECDSA(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s := newTestService(t, Config{Keys: StaticKeys{{Key: &key.PublicKey}}, UserClaim: "email"})
+
+	w := get(s, sign(t, jwt.SigningMethodES256, "", key, jwt.MapClaims{"email": "user@example.com"}))
+	if w.Code != http.StatusOK || w.Body.String() != "user@example.com <nil>" {
+		t.Errorf("ES256 - Expecting: 200 user@example.com; Got: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func writeJWKS(t *testing.T, path string, keys map[string]*rsa.PrivateKey) {
+	t.Helper()
+
+	jwks := `{"keys":[`
+	i := 0
+	for kid, key := range keys {
+		if i > 0 {
+			jwks += ","
+		}
+		i++
+
+		jwks += fmt.Sprintf(`{"kty":"RSA","kid":"%s","use":"sig","n":"%s","e":"%s"}`, kid,
+			base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+	}
+	jwks += `]}`
+
+	if err := ioutil.WriteFile(path, []byte(jwks), 0600); err != nil {
+		t.Fatalf("Write JWKS - Expecting: nil; Got: %s", err)
+	}
+}
+
+func TestJWKSFile(t *testing.T) {
+	first, _ := rsa.GenerateKey(rand.Reader, 2048)
+	second, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]*rsa.PrivateKey{"first": first})
+
+	keys, err := NewJWKSFile(path, time.Minute)
+	if err != nil {
+		t.Fatalf("NewJWKSFile - Expecting: nil; Got: %s", err)
+	}
+
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+
+	s := newTestService(t, Config{Keys: keys})
+
+	if w := get(s, sign(t, jwt.SigningMethodRS256, "first", first, jwt.MapClaims{"sub": "user"})); w.Code != http.StatusOK {
+		t.Errorf("First key - Expecting: 200; Got: %d", w.Code)
+	}
+
+	if w := get(s, sign(t, jwt.SigningMethodRS256, "second", second, jwt.MapClaims{"sub": "user"})); w.Code != http.StatusUnauthorized {
+		t.Errorf("Unknown key - Expecting: 401; Got: %d", w.Code)
+	}
+
+	// The key is rotated, the file is read again after the refresh interval
+	writeJWKS(t, path, map[string]*rsa.PrivateKey{"first": first, "second": second})
+	os.Chtimes(path, now.Add(time.Second), now.Add(time.Second))
+	now = now.Add(time.Minute)
+
+	if w := get(s, sign(t, jwt.SigningMethodRS256, "second", second, jwt.MapClaims{"sub": "user"})); w.Code != http.StatusOK {
+		t.Errorf("Rotated key - Expecting: 200; Got: %d", w.Code)
+	}
+}
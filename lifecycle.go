@@ -0,0 +1,218 @@
+package gohan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// HookFunc is a function called when the service starts or stops.
+type HookFunc func(ctx context.Context) error
+
+// WorkerFunc is a background goroutine managed by the service. It should
+// return when the context is cancelled.
+type WorkerFunc func(ctx context.Context) error
+
+// startHook is a start hook and the number of stop hooks registered before it.
+type startHook struct {
+	fn    HookFunc
+	stops int
+}
+
+type worker struct {
+	name     string
+	fn       WorkerFunc
+	critical bool
+}
+
+// lifecycle holds the hooks and background workers of the service.
+type lifecycle struct {
+	mu      sync.Mutex
+	onStart []startHook
+	onStop  []HookFunc
+	workers []worker
+
+	running bool
+	stopped bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	// receives the error of the first critical worker failing
+	failed chan error
+}
+
+// OnStart registers a hook called before the service starts accepting requests.
+// If a hook fails, the service doesn't start and the stop hooks registered before
+// the failed hook are called in reverse order, so the started resources are released.
+func (s *Service) OnStart(hook HookFunc) {
+	s.lifecycle.mu.Lock()
+	defer s.lifecycle.mu.Unlock()
+
+	s.lifecycle.onStart = append(s.lifecycle.onStart, startHook{fn: hook, stops: len(s.lifecycle.onStop)})
+}
+
+// OnStop registers a hook called after the http server was shutdown and the
+// background workers finished. Hooks are called in reverse order.
+func (s *Service) OnStop(hook HookFunc) {
+	s.lifecycle.mu.Lock()
+	defer s.lifecycle.mu.Unlock()
+
+	s.lifecycle.onStop = append(s.lifecycle.onStop, hook)
+}
+
+// Go runs the function in a background goroutine managed by the service. Its context is
+// cancelled on shutdown, and the service waits for it to return before stopping. Errors
+// are logged. Workers registered before the service runs are started along with it.
+func (s *Service) Go(name string, fn WorkerFunc) {
+	s.goWorker(worker{name: name, fn: fn})
+}
+
+// GoCritical is like Go, but a failure of the worker shuts the whole service down.
+func (s *Service) GoCritical(name string, fn WorkerFunc) {
+	s.goWorker(worker{name: name, fn: fn, critical: true})
+}
+
+func (s *Service) goWorker(w worker) {
+	l := &s.lifecycle
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case l.stopped:
+		s.Logger.Warnf("worker %s not started, the service is stopping", w.name)
+	case l.running:
+		s.startWorker(w)
+	default:
+		l.workers = append(l.workers, w)
+	}
+}
+
+// startWorker runs the worker. The lifecycle lock must be held.
+func (s *Service) startWorker(w worker) {
+	l := &s.lifecycle
+	l.wg.Add(1)
+
+	go func() {
+		defer l.wg.Done()
+
+		err := runWorker(l.ctx, w)
+		if err == nil || (l.ctx.Err() != nil && errors.Is(err, context.Canceled)) {
+			s.Logger.Debugf("worker %s finished", w.name)
+			return
+		}
+
+		s.Logger.Errorf("worker %s failed: %+v", w.name, err)
+
+		if w.critical {
+			select {
+			case l.failed <- fmt.Errorf("worker %s failed: %w", w.name, err):
+			default:
+			}
+		}
+	}()
+}
+
+// runWorker calls the worker function, turning panics into errors.
+func runWorker(ctx context.Context, w worker) (err error) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			err = fmt.Errorf("panic: %v", rcv)
+		}
+	}()
+
+	return w.fn(ctx)
+}
+
+// start calls the start hooks and starts the registered workers.
+func (s *Service) start(ctx context.Context) error {
+	l := &s.lifecycle
+	l.mu.Lock()
+	hooks := l.onStart
+	l.mu.Unlock()
+
+	// Hooks run without the lock, so they can register workers.
+	for _, hook := range hooks {
+		if err := hook.fn(ctx); err != nil {
+			l.mu.Lock()
+			stops := l.onStop[:hook.stops]
+			l.mu.Unlock()
+
+			stopCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+			s.runStopHooks(stopCtx, stops)
+			cancel()
+
+			return fmt.Errorf("failed starting the service: %w", err)
+		}
+	}
+
+	// a previous run left the readiness failing
+	s.Health.ClearShuttingDown()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	l.failed = make(chan error, 1)
+	l.running = true
+
+	for _, w := range l.workers {
+		s.startWorker(w)
+	}
+	l.workers = nil
+
+	return nil
+}
+
+// workerFailed returns the channel receiving the critical workers failures.
+func (s *Service) workerFailed() <-chan error {
+	s.lifecycle.mu.Lock()
+	defer s.lifecycle.mu.Unlock()
+
+	return s.lifecycle.failed
+}
+
+// stop cancels the workers, waits for them until the context is done and calls the stop hooks.
+func (s *Service) stop(ctx context.Context) {
+	l := &s.lifecycle
+	l.mu.Lock()
+	if !l.running {
+		l.mu.Unlock()
+		return
+	}
+	l.running = false
+	l.stopped = true
+	l.cancel()
+	hooks := l.onStop
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.Logger.Debugf("the background workers were stopped")
+	case <-ctx.Done():
+		s.Logger.Errorf("timed out waiting for the background workers to stop")
+	}
+
+	s.runStopHooks(ctx, hooks)
+
+	// the workers registered from now on start with the next run
+	l.mu.Lock()
+	l.stopped = false
+	l.mu.Unlock()
+}
+
+// runStopHooks calls the stop hooks in reverse order.
+func (s *Service) runStopHooks(ctx context.Context, hooks []HookFunc) {
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil {
+			s.Logger.Errorf("failed running stop hook: %+v", err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package gohan
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveTest(t *testing.T, s *Service, ctx context.Context) chan error {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx, ln)
+	}()
+
+	return done
+}
+
+func TestLifecycle(t *testing.T) {
+	s := newTestService(t)
+
+	var events []string
+	started := make(chan struct{})
+
+	s.OnStart(func(ctx context.Context) error {
+		events = append(events, "start")
+		return nil
+	})
+
+	s.Go("worker", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		events = append(events, "worker")
+		return ctx.Err()
+	})
+
+	s.OnStop(func(ctx context.Context) error {
+		events = append(events, "stop 1")
+		return nil
+	})
+
+	s.OnStop(func(ctx context.Context) error {
+		events = append(events, "stop 2")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := serveTest(t, s, ctx)
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expecting the worker to be started")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Serve - Expecting: nil; Got: %s", err)
+	}
+
+	expected := []string{"start", "worker", "stop 2", "stop 1"}
+	if len(events) != len(expected) {
+		t.Fatalf("Expecting: %v; Got: %v", expected, events)
+	}
+
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Expecting: %v; Got: %v", expected, events)
+			break
+		}
+	}
+}
+
+func TestStartHookFailure(t *testing.T) {
+	s := newTestService(t)
+
+	var events []string
+	s.OnStart(func(ctx context.Context) error {
+		events = append(events, "start db")
+		return nil
+	})
+	s.OnStop(func(ctx context.Context) error {
+		events = append(events, "stop db")
+		return nil
+	})
+	s.OnStart(func(ctx context.Context) error {
+		events = append(events, "start queue")
+		return nil
+	})
+	s.OnStop(func(ctx context.Context) error {
+		events = append(events, "stop queue")
+		return nil
+	})
+	s.OnStart(func(ctx context.Context) error {
+		return errors.New("cache unavailable")
+	})
+	s.OnStop(func(ctx context.Context) error {
+		events = append(events, "stop cache")
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Serve(context.Background(), ln); err == nil {
+		t.Errorf("Serve - Expecting: error; Got: nil")
+	}
+
+	if _, err := ln.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Listener - Expecting: closed; Got: %v", err)
+	}
+
+	// only the started hooks are stopped, in reverse order
+	expected := "start db,start queue,stop queue,stop db"
+	if got := strings.Join(events, ","); got != expected {
+		t.Errorf("Expecting: %s; Got: %s", expected, got)
+	}
+}
+
+func TestServeTwice(t *testing.T) {
+	s := newTestService(t)
+
+	for i := 0; i < 2; i++ {
+		started := make(chan struct{})
+		s.Go("worker", func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return nil
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := serveTest(t, s, ctx)
+
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Run %d - Expecting the worker to be started", i+1)
+		}
+
+		w := httptest.NewRecorder()
+		s.Health.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("Run %d, readiness - Expecting: 200; Got: %d", i+1, w.Code)
+		}
+
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("Run %d, Serve - Expecting: nil; Got: %s", i+1, err)
+		}
+	}
+}
+
+func TestCriticalWorkerFailure(t *testing.T) {
+	s := newTestService(t)
+
+	s.Go("failing", func(ctx context.Context) error {
+		return errors.New("not critical")
+	})
+
+	s.GoCritical("consumer", func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		return errors.New("connection lost")
+	})
+
+	select {
+	case err := <-serveTest(t, s, context.Background()):
+		if err == nil || err.Error() != "worker consumer failed: connection lost" {
+			t.Errorf("Serve - Expecting: worker consumer failed: connection lost; Got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Serve - Expecting the service to stop when a critical worker fails")
+	}
+}
@@ -0,0 +1,313 @@
+package gohan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/appnaconda/gohan/response"
+)
+
+// BodyLimit sets the maximum size in bytes of the request body, overriding
+// ServerConfig.MaxBodyBytes. A negative limit removes the limit. Requests announcing a
+// bigger Content-Length are rejected with a 413 problem response before reaching the
+// handler. For the others, reading more than the limit returns a *http.MaxBytesError
+// and the client gets a 413 problem response whatever the handler writes.
+func (r *Route) BodyLimit(n int64) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.bodyLimit = n
+	return r
+}
+
+// Timeout sets the maximum duration of the handler, which runs in its own goroutine.
+// After the timeout, if nothing was written yet, the client gets a 504 problem response
+// and the later writes of the handler are discarded. ServiceContext.Context is cancelled
+// afterwards. Streaming responses already started are left to the handler, which should
+// stop once the context is cancelled.
+func (r *Route) Timeout(d time.Duration) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.timeout = d
+	return r
+}
+
+func (r *Route) limits() (int64, time.Duration) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.bodyLimit, r.timeout
+}
+
+// limit applies the body limit and the timeout of the route.
+func (s *Service) limit(route *Route, h HandlerFunc) HandlerFunc {
+	return func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		bodyLimit, timeout := route.limits()
+		if bodyLimit == 0 {
+			bodyLimit = s.Server.MaxBodyBytes
+		}
+
+		run := h
+		if bodyLimit > 0 && req.Body != nil && req.Body != http.NoBody {
+			if req.ContentLength > bodyLimit {
+				sc.Logger.Infof("request body too large: %d bytes", req.ContentLength)
+				response.Problem(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("the request body exceeds %d bytes", bodyLimit))
+				return
+			}
+
+			body := &limitedBody{ReadCloser: http.MaxBytesReader(w, req.Body, bodyLimit)}
+			req.Body = body
+
+			run = func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+				lw := &bodyLimitWriter{ResponseWriter: w, body: body, limit: bodyLimit}
+				h(sc, lw, req)
+				lw.close(sc)
+			}
+		}
+
+		if timeout <= 0 {
+			run(sc, w, req)
+			return
+		}
+
+		// The context is cancelled once the timeout response is decided, so the handler
+		// can't write in the meantime. context.Cause returns context.DeadlineExceeded.
+		ctx, cancel := context.WithCancelCause(req.Context())
+		defer cancel(nil)
+
+		sc.Context = ctx
+		req = req.WithContext(ctx)
+
+		tw := &timeoutWriter{ResponseWriter: w, header: w.Header().Clone()}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+				close(done)
+			}()
+
+			run(sc, tw, req)
+		}()
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-done:
+		case <-timer.C:
+			timedOut := tw.timeout()
+			cancel(context.DeadlineExceeded)
+
+			if timedOut {
+				sc.Logger.Warnf("handler timed out after %s", timeout)
+				return
+			}
+
+			// The handler started the response, it should stop now that the context
+			// is cancelled
+			<-done
+		}
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		default:
+		}
+	}
+}
+
+// timeoutWriter replies with a 504 on timeout if the handler didn't write anything,
+// the handler writes are discarded afterwards, so they never reach the response once
+// the middleware returned. Only the headers are buffered, so the
+// streaming responses are not delayed.
+type timeoutWriter struct {
+	http.ResponseWriter
+
+	// headers of the handler, copied to the response when it starts writing
+	header http.Header
+
+	mu       sync.Mutex
+	written  bool
+	timedOut bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+// writeHeader sends the headers of the handler. The lock must be held.
+func (w *timeoutWriter) writeHeader(code int) {
+	w.written = true
+
+	dst := w.ResponseWriter.Header()
+	for name := range dst {
+		delete(dst, name)
+	}
+	for name, values := range w.header {
+		dst[name] = values
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// timeout writes the timeout response, it returns false when the handler already
+// started writing.
+func (w *timeoutWriter) timeout() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.written {
+		return false
+	}
+
+	w.timedOut = true
+	response.Problem(w.ResponseWriter, http.StatusGatewayTimeout, "the request timed out")
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return true
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut || w.written {
+		return
+	}
+
+	w.writeHeader(code)
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if !w.written {
+		w.writeHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return
+	}
+
+	if !w.written {
+		w.writeHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original writer, see http.ResponseController.
+func (w *timeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// limitedBody records if the handler read more than the body limit.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		b.exceeded = true
+	}
+
+	return n, err
+}
+
+// bodyLimitWriter replaces the response with a 413 problem response when the handler
+// read more than the body limit.
+type bodyLimitWriter struct {
+	http.ResponseWriter
+
+	body     *limitedBody
+	limit    int64
+	written  bool
+	replaced bool
+}
+
+func (w *bodyLimitWriter) WriteHeader(code int) {
+	if w.written {
+		return
+	}
+
+	if code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.written = true
+	if w.body.exceeded {
+		w.replaced = true
+		w.ResponseWriter.Header().Del("Content-Length")
+		response.Problem(w.ResponseWriter, http.StatusRequestEntityTooLarge, fmt.Sprintf("the request body exceeds %d bytes", w.limit))
+		return
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *bodyLimitWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.replaced {
+		return len(b), nil
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyLimitWriter) Flush() {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.replaced {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original writer, see http.ResponseController.
+func (w *bodyLimitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close writes the 413 response when the handler returned without writing anything.
+func (w *bodyLimitWriter) close(sc *ServiceContext) {
+	if w.body.exceeded {
+		sc.Logger.Infof("request body too large: more than %d bytes", w.limit)
+	}
+
+	if !w.written && w.body.exceeded {
+		w.WriteHeader(http.StatusOK)
+	}
+}
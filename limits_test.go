@@ -0,0 +1,156 @@
+package gohan
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appnaconda/gohan/request"
+	"github.com/appnaconda/gohan/response"
+)
+
+func TestBodyLimit(t *testing.T) {
+	s := newTestService(t)
+	s.Server.MaxBodyBytes = 10
+
+	// The handler only decodes, the framework sends the 413
+	read := func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		var body map[string]string
+		if err := request.Unmarshal(req, &body); err != nil {
+			response.Problem(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		response.JSON(w, body, http.StatusOK)
+	}
+
+	s.POST("/default", read)
+	s.POST("/large", read).BodyLimit(20)
+	s.POST("/unlimited", read).BodyLimit(-1)
+
+	tests := []struct {
+		path    string
+		size    int
+		chunked bool
+		code    int
+	}{
+		{"/default", 10, false, http.StatusOK},
+		{"/default", 11, false, http.StatusRequestEntityTooLarge},
+		{"/default", 11, true, http.StatusRequestEntityTooLarge},
+		{"/large", 20, false, http.StatusOK},
+		{"/large", 21, true, http.StatusRequestEntityTooLarge},
+		{"/unlimited", 1000, false, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		var body io.Reader = strings.NewReader(`{"a":"` + strings.Repeat("a", test.size-8) + `"}`)
+		if test.chunked {
+			// unknown length
+			body = io.MultiReader(body)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, test.path, body)
+		req.Header.Set("Content-Type", "application/json")
+		if test.chunked {
+			req.ContentLength = -1
+		}
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != test.code {
+			t.Errorf("%s with %d bytes - Expecting: %d; Got: %d %s", test.path, test.size, test.code, w.Code, w.Body.String())
+		}
+
+		if test.code == http.StatusRequestEntityTooLarge && w.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("%s with %d bytes - Expecting: problem response; Got: %s", test.path, test.size, w.Body.String())
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	s := newTestService(t)
+
+	cancelled := make(chan bool, 1)
+	s.GET("/slow", func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		<-sc.Context.Done()
+		cancelled <- true
+
+		// discarded
+		w.Header().Set("X-Late", "true")
+		w.Write([]byte("late"))
+	}).Timeout(10 * time.Millisecond)
+
+	s.GET("/stream", func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+
+		<-sc.Context.Done()
+		w.Write([]byte(" second"))
+	}).Timeout(10 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("Timeout - Expecting: 504; Got: %d", w.Code)
+	}
+
+	if !<-cancelled {
+		t.Errorf("Context - Expecting: cancelled")
+	}
+
+	if w.Header().Get("X-Late") != "" || strings.Contains(w.Body.String(), "late") {
+		t.Errorf("Late writes - Expecting: discarded; Got: %s", w.Body.String())
+	}
+
+	// The started responses are left to the handler
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+	if w.Code != http.StatusOK || w.Body.String() != "first second" {
+		t.Errorf("Streaming - Expecting: 200 first second; Got: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	s := newTestService(t)
+	s.GET("/panic", func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		panic("boom")
+	}).Timeout(time.Second)
+
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Errorf("Panic - Expecting: boom; Got: %v", p)
+		}
+	}()
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	t.Errorf("Panic - Expecting: propagated to the caller")
+}
+
+func TestRequestContext(t *testing.T) {
+	s := newTestService(t)
+
+	var err error
+	handler := func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		err = sc.Context.Err()
+	}
+	s.GET("/plain", handler)
+	s.GET("/timed", handler).Timeout(time.Second)
+
+	// every route gets the request context, whatever its limits
+	for _, path := range []string{"/plain", "/timed"} {
+		err = nil
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+		if err != context.Canceled {
+			t.Errorf("%s - Expecting: %s; Got: %v", path, context.Canceled, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package gohan
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// DefaultUnixSocketMode is the permission of the unix socket file when none is configured.
+const DefaultUnixSocketMode os.FileMode = 0660
+
+// First file descriptor passed by systemd on socket activation.
+var listenFdsStart = 3
+
+// listen creates the service listener: the one inherited from systemd, a unix socket
+// or a tcp listener on the given port, depending on the server configuration.
+func (s *Service) listen(port int) (net.Listener, error) {
+	switch {
+	case s.Server.SocketActivation:
+		return activationListener(s.Server.SocketActivationName)
+
+	case s.Server.UnixSocket != "":
+		return listenUnix(s.Server.UnixSocket, s.Server.UnixSocketMode)
+
+	default:
+		addr := net.JoinHostPort(s.Server.Host, strconv.Itoa(port))
+
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed listening on %s: %w", addr, err)
+		}
+
+		return ln, nil
+	}
+}
+
+// listenUnix listens on the unix socket, removing the file left by a previous run.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if mode == 0 {
+		mode = DefaultUnixSocketMode
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed removing the unix socket %s: %w", path, err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed listening on %s: %w", path, err)
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed changing the mode of %s: %w", path, err)
+	}
+
+	return ln, nil
+}
+
+// activationListener returns a listener passed by systemd using the LISTEN_PID, LISTEN_FDS
+// and LISTEN_FDNAMES env variables. When no name is given, the first one is used. The
+// variables are unset, so the child processes don't think the listeners are theirs.
+func activationListener(name string) (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, fmt.Errorf("socket activation - no listener was passed to this process")
+	}
+
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("socket activation - invalid LISTEN_FDS: %q", os.Getenv("LISTEN_FDS"))
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	for i := 0; i < count; i++ {
+		fdName := "LISTEN_FD_" + strconv.Itoa(listenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			fdName = names[i]
+		}
+
+		if name != "" && name != fdName {
+			continue
+		}
+
+		f := os.NewFile(uintptr(listenFdsStart+i), fdName)
+		ln, err := net.FileListener(f)
+		// FileListener dups the file descriptor
+		f.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("socket activation - invalid listener %s: %w", fdName, err)
+		}
+
+		return ln, nil
+	}
+
+	return nil, fmt.Errorf("socket activation - no listener named %s", name)
+}
+
+// h2cHandler allows HTTP/2 requests without TLS when h2c is enabled.
+func (s *Service) h2cHandler(h http.Handler) http.Handler {
+	if !s.Server.H2C {
+		return h
+	}
+
+	return h2c.NewHandler(h, &http2.Server{IdleTimeout: s.Server.IdleTimeout})
+}
@@ -0,0 +1,137 @@
+//go:build !windows
+
+package gohan
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/appnaconda/gohan/response"
+	"golang.org/x/net/http2"
+)
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.sock")
+
+	// A stale socket from a previous run should be replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	s := newTestService(t)
+	s.Server.UnixSocket = path
+	s.Server.UnixSocketMode = 0600
+
+	ln, err := s.listen(0)
+	if err != nil {
+		t.Fatalf("listen - Expecting: nil; Got: %s", err)
+	}
+	defer ln.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Socket mode - Expecting: 0600; Got: %o", info.Mode().Perm())
+	}
+}
+
+func TestSocketActivation(t *testing.T) {
+	tcpLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpLn.Close()
+
+	f, err := tcpLn.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Pretend systemd passed the listener as the second one
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(start int) { listenFdsStart = start }(listenFdsStart)
+	listenFdsStart = fd - 1
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "2")
+	os.Setenv("LISTEN_FDNAMES", "admin:http")
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	ln, err := activationListener("http")
+	if err != nil {
+		t.Fatalf("activationListener - Expecting: nil; Got: %s", err)
+	}
+	defer ln.Close()
+
+	if ln.Addr().String() != tcpLn.Addr().String() {
+		t.Errorf("activationListener - Expecting: %s; Got: %s", tcpLn.Addr(), ln.Addr())
+	}
+
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if _, ok := os.LookupEnv(name); ok {
+			t.Errorf("%s - Expecting: unset", name)
+		}
+	}
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "2")
+	os.Setenv("LISTEN_FDNAMES", "admin:http")
+
+	if _, err := activationListener("grpc"); err == nil {
+		t.Errorf("activationListener unknown name - Expecting: error; Got: nil")
+	}
+}
+
+func TestH2C(t *testing.T) {
+	s := newTestService(t)
+	s.Server.H2C = true
+	s.GET("/proto", func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		response.String(w, req.Proto, http.StatusOK)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Serve(ctx, ln)
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+
+	res, err := client.Get(fmt.Sprintf("http://%s/proto", ln.Addr()))
+	if err != nil {
+		t.Fatalf("GET /proto - Expecting: nil; Got: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.ProtoMajor != 2 {
+		t.Errorf("Protocol - Expecting: HTTP/2; Got: %s", res.Proto)
+	}
+}
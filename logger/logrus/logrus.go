@@ -53,22 +53,27 @@ func (l *logrusLogger) Fatalf(format string, args ...interface{}) {
 	l.logger.Fatalf(format, args...)
 }
 
+// The setters use the logrus ones, which are safe to call while logging.
 func (l *logrusLogger) SetLevel(level logger.Level) error {
-	var err error
-	l.logger.Logger.Level, err = logrus.ParseLevel(level.String())
-	return err
+	lvl, err := logrus.ParseLevel(level.String())
+	if err != nil {
+		return err
+	}
+
+	l.logger.Logger.SetLevel(lvl)
+	return nil
 }
 
 func (l *logrusLogger) SetOutput(output io.Writer) {
-	l.logger.Logger.Out = output
+	l.logger.Logger.SetOutput(output)
 }
 
 func (l *logrusLogger) SetOutputFormat(f logger.Format) error {
 	switch strings.ToLower(f.String()) {
 	case "text":
-		l.logger.Logger.Formatter = &logrus.TextFormatter{}
+		l.logger.Logger.SetFormatter(&logrus.TextFormatter{})
 	case "json":
-		l.logger.Logger.Formatter = &logrus.JSONFormatter{}
+		l.logger.Logger.SetFormatter(&logrus.JSONFormatter{})
 	default:
 		return fmt.Errorf("invalid log output format: %s. JSON will be used by default", f.String())
 	}
@@ -0,0 +1,171 @@
+// Package metrics records the service RED metrics (rate, errors and duration) and
+// exposes them using the prometheus text format.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the http collectors and the registry they are exposed from.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+	cache    *prometheus.CounterVec
+
+	breakerState       *prometheus.GaugeVec
+	breakerTransitions *prometheus.CounterVec
+}
+
+// New creates the http collectors and registers them, along with the go runtime
+// and process collectors, in a new registry.
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of http requests.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Duration of the http requests in seconds.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of http requests being served.",
+		}, []string{"method", "route"}),
+		cache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_cache_requests_total",
+			Help: "Total number of requests through the response caches, by result.",
+		}, []string{"cache", "result"}),
+		breakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "circuit_breaker_state",
+			Help: "State of the circuit breakers: 0 closed, 1 half-open, 2 open.",
+		}, []string{"name"}),
+		breakerTransitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "circuit_breaker_transitions_total",
+			Help: "Total number of state transitions of the circuit breakers.",
+		}, []string{"name", "from", "to"}),
+	}
+
+	m.Registry.MustRegister(
+		m.requests,
+		m.duration,
+		m.inFlight,
+		m.cache,
+		m.breakerState,
+		m.breakerTransitions,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// RegisterDB exports the connection pool stats of the database.
+func (m *Metrics) RegisterDB(name string, db *sql.DB) error {
+	return m.Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler returns the http handler serving the metrics in the prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// Instrument wraps the handler recording the metrics of every request. The route
+// should be the pattern the handler was registered with, not the request path,
+// to keep the label cardinality bounded.
+func (m *Metrics) Instrument(method, route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		inFlight := m.inFlight.WithLabelValues(method, route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+
+		defer func() {
+			status := strconv.Itoa(sw.Status())
+			m.requests.WithLabelValues(method, route, status).Inc()
+			m.duration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+		}()
+
+		h(sw, req)
+	}
+}
+
+// ObserveCache counts a request through the response cache with the given name. The
+// result is hit, miss, stale or bypass, see the cache package.
+func (m *Metrics) ObserveCache(name, result string) {
+	m.cache.WithLabelValues(name, result).Inc()
+}
+
+// ObserveBreaker records a state transition of the circuit breaker with the given
+// name, state is the numeric value of the new state, see the breaker package.
+func (m *Metrics) ObserveBreaker(name, from, to string, state int) {
+	m.SetBreakerState(name, state)
+	m.breakerTransitions.WithLabelValues(name, from, to).Inc()
+}
+
+// SetBreakerState sets the state of the circuit breaker with the given name without
+// recording a transition, e.g. when the breaker is created.
+func (m *Metrics) SetBreakerState(name string, state int) {
+	m.breakerState.WithLabelValues(name).Set(float64(state))
+}
+
+// DeleteBreaker removes the series of the circuit breaker with the given name, e.g.
+// when a breaker.Transport drops the breaker of a host.
+func (m *Metrics) DeleteBreaker(name string) {
+	m.breakerState.DeleteLabelValues(name)
+	m.breakerTransitions.DeletePartialMatch(prometheus.Labels{"name": name})
+}
+
+// statusWriter records the status code written by the handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the status code sent to the client. Handlers not writing
+// anything end up sending a 200.
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
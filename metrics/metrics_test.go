@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInstrument(t *testing.T) {
+	m := New()
+
+	h := m.Instrument(http.MethodGet, "/users/:id", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/2", nil))
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+
+	expected := []string{
+		`http_requests_total{method="GET",route="/users/:id",status="404"} 2`,
+		`http_request_duration_seconds_count{method="GET",route="/users/:id",status="404"} 2`,
+		`http_requests_in_flight{method="GET",route="/users/:id"} 0`,
+		`go_goroutines`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expecting metrics to contain %s", e)
+		}
+	}
+}
+
+func TestStatusWriterDefault(t *testing.T) {
+	sw := &statusWriter{ResponseWriter: httptest.NewRecorder()}
+	sw.Write([]byte("hello"))
+
+	if sw.Status() != http.StatusOK {
+		t.Errorf("Expecting: %d; Got: %d", http.StatusOK, sw.Status())
+	}
+}
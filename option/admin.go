@@ -0,0 +1,22 @@
+package option
+
+import (
+	"github.com/appnaconda/gohan"
+)
+
+// WithAdmin serves the internal endpoints (metrics, profiling, route dumps, log level, ...)
+// on a separate listener instead of the public one.
+func WithAdmin(addr string, middlewares ...gohan.MiddlewareFunc) gohan.Option {
+	return withAdmin{addr: addr, middlewares: middlewares}
+}
+
+type withAdmin struct {
+	addr        string
+	middlewares []gohan.MiddlewareFunc
+}
+
+func (a withAdmin) Apply(s *gohan.Service) error {
+	s.Admin.Addr = a.addr
+	s.Admin.Use(a.middlewares...)
+	return nil
+}
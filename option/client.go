@@ -0,0 +1,21 @@
+package option
+
+import (
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/client"
+)
+
+// WithHTTPClient replaces http.DefaultClient as the service client with one using
+// timeouts and retrying the failed idempotent requests, see the client package.
+func WithHTTPClient(config client.Config) gohan.Option {
+	return withHTTPClient{config: config}
+}
+
+type withHTTPClient struct {
+	config client.Config
+}
+
+func (c withHTTPClient) Apply(s *gohan.Service) error {
+	s.HttpClient = client.New(c.config)
+	return nil
+}
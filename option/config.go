@@ -0,0 +1,19 @@
+package option
+
+import (
+	"github.com/appnaconda/gohan"
+)
+
+// WithConfig loads the configuration struct pointer using config.Load. The configuration
+// is reloaded on SIGHUP, use Service.Config to get the current one.
+func WithConfig(cfg interface{}) gohan.Option {
+	return withConfig{cfg: cfg}
+}
+
+type withConfig struct {
+	cfg interface{}
+}
+
+func (c withConfig) Apply(s *gohan.Service) error {
+	return s.LoadConfig(c.cfg)
+}
@@ -0,0 +1,29 @@
+package option
+
+import (
+	"github.com/appnaconda/gohan"
+)
+
+// WithCORS sets the CORS policy applied to every route of the service.
+func WithCORS(policy gohan.CORSPolicy) gohan.Option {
+	return withCORS{policy: &policy}
+}
+
+// WithCORSAllowAll allows cross-origin requests from any origin, using any common method and header.
+func WithCORSAllowAll() gohan.Option {
+	return withCORS{policy: gohan.AllowAllCORSPolicy()}
+}
+
+// WithoutCORS disables CORS, no CORS headers will be sent.
+func WithoutCORS() gohan.Option {
+	return withCORS{policy: nil}
+}
+
+type withCORS struct {
+	policy *gohan.CORSPolicy
+}
+
+func (c withCORS) Apply(s *gohan.Service) error {
+	s.CORS = c.policy
+	return nil
+}
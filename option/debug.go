@@ -0,0 +1,27 @@
+package option
+
+import (
+	"errors"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/debug"
+)
+
+// WithDebugEndpoints mounts the pprof, expvar, goroutine dump and build information
+// endpoints on the admin endpoints. See debug.Register for the list of endpoints.
+// The endpoints are never public, the admin address must be set by a previous option,
+// e.g. WithAdmin, otherwise use debug.Register with a guarded route group.
+func WithDebugEndpoints() gohan.Option {
+	return withDebugEndpoints{}
+}
+
+type withDebugEndpoints struct{}
+
+func (withDebugEndpoints) Apply(s *gohan.Service) error {
+	if s.Admin.Addr == "" {
+		return errors.New("the debug endpoints need an admin address, use option.WithAdmin before option.WithDebugEndpoints or debug.Register with a guarded route group")
+	}
+
+	debug.Register(s.Admin, s)
+	return nil
+}
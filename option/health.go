@@ -0,0 +1,43 @@
+package option
+
+import (
+	"net/http"
+
+	"github.com/appnaconda/gohan"
+)
+
+// WithHealthEndpoints exposes the service health checks. The liveness endpoint only runs
+// the liveness checks, the readiness endpoint runs every check and fails while the
+// service is shutting down. An empty path skips the endpoint.
+func WithHealthEndpoints(livenessPath, readinessPath string) gohan.Option {
+	return withHealthEndpoints{livenessPath: livenessPath, readinessPath: readinessPath}
+}
+
+// WithDefaultHealthEndpoints exposes the health checks at /healthz and /readyz.
+func WithDefaultHealthEndpoints() gohan.Option {
+	return WithHealthEndpoints("/healthz", "/readyz")
+}
+
+type withHealthEndpoints struct {
+	livenessPath  string
+	readinessPath string
+}
+
+func (he withHealthEndpoints) Apply(s *gohan.Service) error {
+	if he.livenessPath != "" {
+		s.GET(he.livenessPath, serveHTTP(s.Health.LivenessHandler()))
+	}
+
+	if he.readinessPath != "" {
+		s.GET(he.readinessPath, serveHTTP(s.Health.ReadinessHandler()))
+	}
+
+	return nil
+}
+
+// serveHTTP adapts a http.Handler to a gohan.HandlerFunc.
+func serveHTTP(h http.Handler) gohan.HandlerFunc {
+	return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(w, req)
+	}
+}
@@ -0,0 +1,53 @@
+package option
+
+import (
+	"os"
+
+	"github.com/appnaconda/gohan"
+)
+
+// WithH2C serves HTTP/2 without TLS (h2c) along with HTTP/1.
+func WithH2C() gohan.Option {
+	return withH2C{}
+}
+
+type withH2C struct{}
+
+func (withH2C) Apply(s *gohan.Service) error {
+	s.Server.H2C = true
+	return nil
+}
+
+// WithUnixSocket listens on a unix socket instead of a tcp port. The socket file
+// is created with the given permissions, or gohan.DefaultUnixSocketMode when zero.
+func WithUnixSocket(path string, mode os.FileMode) gohan.Option {
+	return withUnixSocket{path: path, mode: mode}
+}
+
+type withUnixSocket struct {
+	path string
+	mode os.FileMode
+}
+
+func (us withUnixSocket) Apply(s *gohan.Service) error {
+	s.Server.UnixSocket = us.path
+	s.Server.UnixSocketMode = us.mode
+	return nil
+}
+
+// WithSocketActivation uses the listener passed by systemd (socket activation) instead of
+// creating one. The name is the FileDescriptorName of the socket unit, the first listener
+// is used when empty.
+func WithSocketActivation(name string) gohan.Option {
+	return withSocketActivation{name: name}
+}
+
+type withSocketActivation struct {
+	name string
+}
+
+func (sa withSocketActivation) Apply(s *gohan.Service) error {
+	s.Server.SocketActivation = true
+	s.Server.SocketActivationName = sa.name
+	return nil
+}
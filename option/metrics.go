@@ -0,0 +1,62 @@
+package option
+
+import (
+	"net/http"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/metrics"
+)
+
+// WithMetrics records the request metrics and exposes them at the given path of the
+// admin endpoints. Without admin address, see WithAdmin, they are exposed at the path
+// on the public listener.
+func WithMetrics(path string) gohan.Option {
+	return withMetrics{path: path}
+}
+
+// WithMetricsServer records the request metrics and exposes them at /metrics on
+// the admin listener, which is started on the given address.
+func WithMetricsServer(addr string) gohan.Option {
+	return withMetrics{path: "/metrics", addr: addr}
+}
+
+type withMetrics struct {
+	path string
+	addr string
+}
+
+func (m withMetrics) Apply(s *gohan.Service) error {
+	if s.Metrics == nil {
+		s.Metrics = metrics.New()
+
+		if db, err := s.GetDB(); err == nil {
+			if err := s.Metrics.RegisterDB("database", db); err != nil {
+				return err
+			}
+		}
+	}
+
+	if m.path != "" {
+		s.Admin.HandleHTTP(m.path, s.Metrics.Handler())
+	}
+
+	if m.addr != "" {
+		s.Admin.Addr = m.addr
+		return nil
+	}
+
+	if m.path != "" {
+		// The admin address can be set by a later option, it's checked on each request
+		h := s.Metrics.Handler()
+		s.GET(m.path, func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+			if s.Admin.Addr != "" {
+				http.NotFound(w, req)
+				return
+			}
+
+			h.ServeHTTP(w, req)
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package option
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appnaconda/gohan"
+)
+
+func TestWithMetrics(t *testing.T) {
+	tests := []struct {
+		name          string
+		options       []gohan.Option
+		public, admin int
+	}{
+		{"No admin address", []gohan.Option{WithMetrics("/metrics")}, http.StatusOK, http.StatusOK},
+		{"Admin after", []gohan.Option{WithMetrics("/metrics"), WithAdmin("127.0.0.1:0")}, http.StatusNotFound, http.StatusOK},
+		{"Admin before", []gohan.Option{WithAdmin("127.0.0.1:0"), WithMetrics("/metrics")}, http.StatusNotFound, http.StatusOK},
+		{"Metrics server", []gohan.Option{WithMetricsServer("127.0.0.1:0")}, http.StatusNotFound, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		s, err := gohan.New(context.Background(), test.options...)
+		if err != nil {
+			t.Fatalf("%s, New - Expecting: nil; Got: %s", test.name, err)
+		}
+		s.Logger.SetOutput(ioutil.Discard)
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if w.Code != test.public {
+			t.Errorf("%s, public /metrics - Expecting: %d; Got: %d", test.name, test.public, w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		s.Admin.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if w.Code != test.admin {
+			t.Errorf("%s, admin /metrics - Expecting: %d; Got: %d", test.name, test.admin, w.Code)
+		}
+	}
+}
+
+func TestWithDebugEndpoints(t *testing.T) {
+	if _, err := gohan.New(context.Background(), WithDebugEndpoints()); err == nil {
+		t.Errorf("No admin address - Expecting: error; Got: nil")
+	}
+
+	s, err := gohan.New(context.Background(), WithAdmin("127.0.0.1:0"), WithDebugEndpoints())
+	if err != nil {
+		t.Fatalf("Admin address - Expecting: nil; Got: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	s.Admin.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/buildinfo", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Admin /debug/buildinfo - Expecting: 200; Got: %d", w.Code)
+	}
+}
@@ -0,0 +1,66 @@
+package option
+
+import (
+	"github.com/appnaconda/gohan"
+)
+
+// WithServerConfig sets the bind address, timeouts and shutdown grace period of the service http servers.
+// Only the non-zero fields are set, the other ones keep their defaults or the values set by the
+// other options, whatever their order. Use a negative timeout to disable a default one, e.g.
+// IdleTimeout: -1.
+func WithServerConfig(config gohan.ServerConfig) gohan.Option {
+	return withServerConfig{config: config}
+}
+
+type withServerConfig struct {
+	config gohan.ServerConfig
+}
+
+func (sc withServerConfig) Apply(s *gohan.Service) error {
+	c := sc.config
+
+	if c.Host != "" {
+		s.Server.Host = c.Host
+	}
+	if c.ReadTimeout != 0 {
+		s.Server.ReadTimeout = c.ReadTimeout
+	}
+	if c.ReadHeaderTimeout != 0 {
+		s.Server.ReadHeaderTimeout = c.ReadHeaderTimeout
+	}
+	if c.WriteTimeout != 0 {
+		s.Server.WriteTimeout = c.WriteTimeout
+	}
+	if c.IdleTimeout != 0 {
+		s.Server.IdleTimeout = c.IdleTimeout
+	}
+	if c.MaxHeaderBytes != 0 {
+		s.Server.MaxHeaderBytes = c.MaxHeaderBytes
+	}
+	if c.MaxBodyBytes != 0 {
+		s.Server.MaxBodyBytes = c.MaxBodyBytes
+	}
+	if c.DrainDelay != 0 {
+		s.Server.DrainDelay = c.DrainDelay
+	}
+	if c.ShutdownTimeout != 0 {
+		s.Server.ShutdownTimeout = c.ShutdownTimeout
+	}
+	if c.H2C {
+		s.Server.H2C = true
+	}
+	if c.UnixSocket != "" {
+		s.Server.UnixSocket = c.UnixSocket
+	}
+	if c.UnixSocketMode != 0 {
+		s.Server.UnixSocketMode = c.UnixSocketMode
+	}
+	if c.SocketActivation {
+		s.Server.SocketActivation = true
+	}
+	if c.SocketActivationName != "" {
+		s.Server.SocketActivationName = c.SocketActivationName
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package option
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/appnaconda/gohan"
+)
+
+func TestWithServerConfig(t *testing.T) {
+	config := WithServerConfig(gohan.ServerConfig{Host: "127.0.0.1", WriteTimeout: time.Minute})
+	h2c := WithH2C()
+	socket := WithUnixSocket("/tmp/gohan.sock", 0600)
+
+	var servers []gohan.ServerConfig
+	for _, options := range [][]gohan.Option{
+		{config, h2c, socket},
+		{h2c, socket, config},
+	} {
+		s, err := gohan.New(context.Background(), options...)
+		if err != nil {
+			t.Fatalf("New - Expecting: nil; Got: %s", err)
+		}
+		servers = append(servers, s.Server)
+	}
+
+	for i, server := range servers {
+		if server.Host != "127.0.0.1" || server.WriteTimeout != time.Minute {
+			t.Errorf("Order %d, config - Expecting: 127.0.0.1 1m; Got: %s %s", i, server.Host, server.WriteTimeout)
+		}
+
+		if !server.H2C || server.UnixSocket != "/tmp/gohan.sock" {
+			t.Errorf("Order %d, listener options - Expecting: kept; Got: %+v", i, server)
+		}
+
+		if server.ReadHeaderTimeout != gohan.DefaultReadHeaderTimeout || server.ShutdownTimeout != gohan.DefaultShutdownTimeout {
+			t.Errorf("Order %d, defaults - Expecting: kept; Got: %+v", i, server)
+		}
+	}
+
+	if !reflect.DeepEqual(servers[0], servers[1]) {
+		t.Errorf("Order - Expecting: same configuration; Got: %+v and %+v", servers[0], servers[1])
+	}
+}
+
+func TestWithServerConfigDisabledTimeouts(t *testing.T) {
+	s, err := gohan.New(context.Background(), WithServerConfig(gohan.ServerConfig{ReadHeaderTimeout: -1, IdleTimeout: -1}))
+	if err != nil {
+		t.Fatalf("New - Expecting: nil; Got: %s", err)
+	}
+
+	if s.Server.ReadHeaderTimeout >= 0 || s.Server.IdleTimeout >= 0 {
+		t.Errorf("Disabled timeouts - Expecting: negative; Got: %s %s", s.Server.ReadHeaderTimeout, s.Server.IdleTimeout)
+	}
+
+	if s.Server.ShutdownTimeout != gohan.DefaultShutdownTimeout {
+		t.Errorf("Shutdown timeout - Expecting: %s; Got: %s", gohan.DefaultShutdownTimeout, s.Server.ShutdownTimeout)
+	}
+}
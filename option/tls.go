@@ -0,0 +1,20 @@
+package option
+
+import (
+	"github.com/appnaconda/gohan"
+)
+
+// WithTLS serves https using the given certificates. The certificate files are reloaded
+// when they change on disk and setting a client CA file enables mutual TLS.
+func WithTLS(config gohan.TLSConfig) gohan.Option {
+	return withTLS{config: config}
+}
+
+type withTLS struct {
+	config gohan.TLSConfig
+}
+
+func (t withTLS) Apply(s *gohan.Service) error {
+	s.TLS = &t.config
+	return nil
+}
@@ -0,0 +1,162 @@
+// Package ratelimit contains a token bucket rate limiting middleware.
+//
+// A limiter can be used for the whole service, a group or a single route:
+//
+//	service.Use(ratelimit.New(ratelimit.Config{Limit: ratelimit.PerSecond(10)}))
+//	service.POST("/login", login, ratelimit.New(ratelimit.Config{
+//		Limit: ratelimit.PerMinute(5),
+//	}))
+//
+// Every limiter has its own buckets, so a request going through several limiters
+// takes a token from each of them.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/response"
+)
+
+// Limit is the number of requests allowed per period. Burst is the maximum number of
+// requests allowed at once, it defaults to Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// PerSecond returns a limit of n requests per second.
+func PerSecond(n int) Limit {
+	return Limit{Requests: n, Period: time.Second}
+}
+
+// PerMinute returns a limit of n requests per minute.
+func PerMinute(n int) Limit {
+	return Limit{Requests: n, Period: time.Minute}
+}
+
+// PerHour returns a limit of n requests per hour.
+func PerHour(n int) Limit {
+	return Limit{Requests: n, Period: time.Hour}
+}
+
+// rate returns the tokens earned per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// KeyFunc returns the key identifying the client of the request. Requests with an
+// empty key are limited by client IP.
+type KeyFunc func(sc *gohan.ServiceContext, req *http.Request) string
+
+// ByIP identifies the clients by the IP of the connection. Behind a proxy, use ByHeader
+// with the header the proxy sets with the client IP.
+func ByIP(sc *gohan.ServiceContext, req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// ByHeader identifies the clients by the value of a header, e.g. an API key.
+func ByHeader(name string) KeyFunc {
+	return func(sc *gohan.ServiceContext, req *http.Request) string {
+		return req.Header.Get(name)
+	}
+}
+
+// ByUser identifies the clients by the authenticated user (ServiceContext.LoggedUserIdentifier).
+func ByUser(sc *gohan.ServiceContext, req *http.Request) string {
+	return sc.LoggedUserIdentifier
+}
+
+// Config contains the settings of a limiter.
+type Config struct {
+	Limit Limit
+
+	// Identifies the client of the request. Defaults to ByIP.
+	Key KeyFunc
+
+	// Where the buckets are kept. Defaults to a new memory store.
+	Store Store
+
+	// Prefix of the keys in the store, so limiters sharing a store don't share buckets.
+	// A unique name is generated when empty.
+	Name string
+}
+
+var limiterCount int64
+
+// New returns a middleware limiting the requests of every client to the configured limit.
+// Requests over the limit get a 429 problem response with a Retry-After header.
+func New(config Config) gohan.MiddlewareFunc {
+	if config.Limit.Requests <= 0 || config.Limit.Period <= 0 {
+		panic(fmt.Errorf("ratelimit - invalid limit: %d per %s", config.Limit.Requests, config.Limit.Period))
+	}
+
+	if config.Key == nil {
+		config.Key = ByIP
+	}
+
+	if config.Store == nil {
+		config.Store = NewMemoryStore()
+	}
+
+	if config.Name == "" {
+		config.Name = "limiter" + strconv.FormatInt(atomic.AddInt64(&limiterCount, 1), 10)
+	}
+
+	policy := fmt.Sprintf("%d;w=%d", config.Limit.burst(), int(math.Ceil(config.Limit.Period.Seconds())))
+
+	return func(next gohan.HandlerFunc) gohan.HandlerFunc {
+		return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+			key := config.Key(sc, req)
+			if key == "" {
+				key = ByIP(sc, req)
+			}
+
+			result, err := config.Store.Take(req.Context(), config.Name+":"+key, config.Limit)
+			if err != nil {
+				// Failing open, an unavailable store shouldn't take the service down
+				sc.Logger.Errorf("failed checking the rate limit: %+v", err)
+				next(sc, w, req)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", policy)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(config.Limit.burst()))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				retryAfter := ceilSeconds(result.RetryAfter)
+				sc.Logger.Infof("rate limit exceeded by %s", key)
+
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				response.Problem(w, http.StatusTooManyRequests, fmt.Sprintf("rate limit exceeded, retry in %d seconds", retryAfter))
+				return
+			}
+
+			next(sc, w, req)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
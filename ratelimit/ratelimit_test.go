@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/internal/gohantest"
+)
+
+func ok(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func get(s *gohan.Service, path, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	req := gohantest.NewRequest(http.MethodGet, path, nil, headers)
+	req.RemoteAddr = remoteAddr
+	return gohantest.Serve(s, req)
+}
+
+func TestMiddleware(t *testing.T) {
+	s := gohantest.NewService(t)
+	s.GET("/", ok, New(Config{Limit: Limit{Requests: 1, Period: time.Minute, Burst: 2}}))
+
+	for i := 0; i < 2; i++ {
+		w := get(s, "/", "10.0.0.1:1234", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Request %d - Expecting: 200; Got: %d", i, w.Code)
+		}
+	}
+
+	w := get(s, "/", "10.0.0.1:5678", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Over the limit - Expecting: 429; Got: %d", w.Code)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type - Expecting: application/problem+json; Got: %s", ct)
+	}
+
+	if retry := w.Header().Get("Retry-After"); retry != "60" {
+		t.Errorf("Retry-After - Expecting: 60; Got: %s", retry)
+	}
+
+	if limit := w.Header().Get("RateLimit-Limit"); limit != "2" {
+		t.Errorf("RateLimit-Limit - Expecting: 2; Got: %s", limit)
+	}
+
+	if remaining := w.Header().Get("RateLimit-Remaining"); remaining != "0" {
+		t.Errorf("RateLimit-Remaining - Expecting: 0; Got: %s", remaining)
+	}
+
+	if policy := w.Header().Get("RateLimit-Policy"); policy != "2;w=60" {
+		t.Errorf("RateLimit-Policy - Expecting: 2;w=60; Got: %s", policy)
+	}
+
+	// Other clients have their own bucket
+	if w := get(s, "/", "10.0.0.2:1234", nil); w.Code != http.StatusOK {
+		t.Errorf("Other client - Expecting: 200; Got: %d", w.Code)
+	}
+}
+
+func TestMiddlewareKeys(t *testing.T) {
+	s := gohantest.NewService(t)
+	s.GET("/", ok, New(Config{Limit: PerMinute(1), Key: ByHeader("X-API-Key")}))
+
+	if w := get(s, "/", "10.0.0.1:1234", map[string]string{"X-API-Key": "a"}); w.Code != http.StatusOK {
+		t.Errorf("First key - Expecting: 200; Got: %d", w.Code)
+	}
+
+	if w := get(s, "/", "10.0.0.1:1234", map[string]string{"X-API-Key": "b"}); w.Code != http.StatusOK {
+		t.Errorf("Second key - Expecting: 200; Got: %d", w.Code)
+	}
+
+	if w := get(s, "/", "10.0.0.1:1234", map[string]string{"X-API-Key": "a"}); w.Code != http.StatusTooManyRequests {
+		t.Errorf("First key again - Expecting: 429; Got: %d", w.Code)
+	}
+
+	// Without key, the requests are limited by IP
+	if w := get(s, "/", "10.0.0.1:1234", nil); w.Code != http.StatusOK {
+		t.Errorf("No key - Expecting: 200; Got: %d", w.Code)
+	}
+
+	if w := get(s, "/", "10.0.0.1:1234", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("No key again - Expecting: 429; Got: %d", w.Code)
+	}
+}
+
+func TestMiddlewarePerRoute(t *testing.T) {
+	store := NewMemoryStore()
+
+	s := gohantest.NewService(t)
+	s.GET("/a", ok, New(Config{Limit: PerMinute(1), Store: store}))
+	s.GET("/b", ok, New(Config{Limit: PerMinute(1), Store: store}))
+
+	for _, path := range []string{"/a", "/b"} {
+		if w := get(s, path, "10.0.0.1:1234", nil); w.Code != http.StatusOK {
+			t.Errorf("%s - Expecting: 200; Got: %d", path, w.Code)
+		}
+	}
+
+	if w := get(s, "/a", "10.0.0.1:1234", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("/a again - Expecting: 429; Got: %d", w.Code)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	limit := PerSecond(2)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if result, _ := store.Take(ctx, "key", limit); !result.Allowed {
+			t.Fatalf("Take %d - Expecting: allowed; Got: %+v", i, result)
+		}
+	}
+
+	result, _ := store.Take(ctx, "key", limit)
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Empty bucket - Expecting: retry after 500ms; Got: %+v", result)
+	}
+
+	// A token is earned every 500ms
+	now = now.Add(500 * time.Millisecond)
+	if result, _ := store.Take(ctx, "key", limit); !result.Allowed {
+		t.Errorf("Refilled bucket - Expecting: allowed; Got: %+v", result)
+	}
+
+	// The full buckets are evicted
+	now = now.Add(DefaultSweepInterval)
+	store.Take(ctx, "other", limit)
+
+	if store.Len() != 1 {
+		t.Errorf("Eviction - Expecting: 1 bucket; Got: %d", store.Len())
+	}
+}
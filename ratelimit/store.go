@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Result is the state of a bucket after taking a token.
+type Result struct {
+	// Whether the request is allowed.
+	Allowed bool
+
+	// Number of requests that can still be made right now.
+	Remaining int
+
+	// Time until the bucket is full again.
+	Reset time.Duration
+
+	// Time until the next request is allowed. Zero when the request is allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the token buckets. Implementations must be safe for concurrent use,
+// a shared backend (e.g. redis) allows limiting across several instances.
+type Store interface {
+	// Take removes a token from the bucket identified by the key.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// DefaultSweepInterval is how often the memory store evicts the idle buckets.
+const DefaultSweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// time at which the bucket is full again and can be evicted
+	full time.Time
+}
+
+// MemoryStore keeps the buckets in memory. Buckets that are full again are
+// evicted, so the memory used is bounded by the number of active clients.
+type MemoryStore struct {
+	mu            sync.Mutex
+	buckets       map[string]*bucket
+	lastSweep     time.Time
+	sweepInterval time.Duration
+
+	// used by the tests
+	now func() time.Time
+}
+
+// NewMemoryStore returns an empty memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:       make(map[string]*bucket),
+		sweepInterval: DefaultSweepInterval,
+		now:           time.Now,
+	}
+}
+
+// Take implements the Store interface.
+func (m *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	rate := limit.rate()
+	burst := float64(limit.burst())
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		m.buckets[key] = b
+	}
+
+	// refill the bucket with the tokens earned since the last request
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	result := Result{}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((burst - b.tokens) / rate)
+	b.full = now.Add(result.Reset)
+
+	return result, nil
+}
+
+// sweep evicts the full buckets. The lock must be held.
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < m.sweepInterval {
+		return
+	}
+
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of buckets in the store.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.buckets)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,129 @@
+package gohan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/appnaconda/gohan/config"
+	"github.com/appnaconda/gohan/logger"
+)
+
+// OnReload registers a hook called when the service is reloaded (e.g. on SIGHUP).
+func (s *Service) OnReload(hook HookFunc) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.onReload = append(s.onReload, hook)
+}
+
+// LoadConfig loads the configuration into the struct pointer using config.Load. The
+// configuration is loaded again into a new struct on every reload, see Config.
+func (s *Service) LoadConfig(cfg interface{}) error {
+	if err := config.Load(cfg); err != nil {
+		return err
+	}
+
+	s.configMu.Lock()
+	s.config = cfg
+	s.configMu.Unlock()
+
+	return nil
+}
+
+// Config returns the last configuration loaded by LoadConfig. The returned struct is never
+// modified by a reload, so it is safe to keep it for the duration of a request.
+func (s *Service) Config() interface{} {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+
+	return s.config
+}
+
+// Reload runs the reload pipeline: it loads the configuration again, re-reads the
+// LOG_LEVEL and LOG_FORMAT env variables, reloads the tls certificates and calls the
+// reload hooks. A failing step doesn't stop the next ones and keeps its previous state.
+func (s *Service) Reload(ctx context.Context) error {
+	s.reloadMu.Lock()
+
+	s.Logger.Infof("reloading the service")
+
+	var errs []error
+
+	if err := s.reloadConfig(); err != nil {
+		errs = append(errs, fmt.Errorf("failed reloading the config: %w", err))
+	}
+
+	if err := s.reloadLogSettings(); err != nil {
+		errs = append(errs, fmt.Errorf("failed reloading the log settings: %w", err))
+	}
+
+	if s.certs != nil {
+		if err := s.certs.Reload(); err != nil {
+			errs = append(errs, fmt.Errorf("failed reloading the tls certificates: %w", err))
+		}
+	}
+
+	hooks := s.onReload
+	s.reloadMu.Unlock()
+
+	// Hooks run without the lock, so they can register hooks or reload the service.
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed running reload hook: %w", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	s.Logger.Infof("the service was reloaded")
+	return nil
+}
+
+// reloadConfig loads the configuration into a new struct of the same type and swaps it.
+func (s *Service) reloadConfig() error {
+	current := s.Config()
+	if current == nil {
+		return nil
+	}
+
+	cfg := reflect.New(reflect.TypeOf(current).Elem()).Interface()
+	return s.LoadConfig(cfg)
+}
+
+func (s *Service) reloadLogSettings() error {
+	s.logMu.RLock()
+	level, format := logSettingsFromEnv(s.logLevel, s.logFormat)
+	changed := level != s.logLevel || format != s.logFormat
+	s.logMu.RUnlock()
+
+	if !changed {
+		return nil
+	}
+
+	if err := s.SetLogLevel(level); err != nil {
+		return err
+	}
+
+	if err := s.setLogFormat(format); err != nil {
+		return err
+	}
+
+	s.Logger.Infof("log settings changed to level %s and format %s", level, format)
+	return nil
+}
+
+func (s *Service) setLogFormat(format logger.Format) error {
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+
+	if err := s.Logger.SetOutputFormat(format); err != nil {
+		return err
+	}
+
+	s.logFormat = format
+	return nil
+}
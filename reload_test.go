@@ -0,0 +1,113 @@
+package gohan
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/appnaconda/gohan/logger"
+)
+
+type reloadTestConfig struct {
+	Greeting string `default:"hello"`
+}
+
+func TestReload(t *testing.T) {
+	s := newTestService(t)
+
+	first := &reloadTestConfig{}
+	if err := s.LoadConfig(first); err != nil {
+		t.Fatalf("LoadConfig - Expecting: nil; Got: %s", err)
+	}
+
+	var hooks int
+	s.OnReload(func(ctx context.Context) error {
+		hooks++
+		return nil
+	})
+
+	os.Setenv("GREETING", "hola")
+	os.Setenv("LOG_LEVEL", "ERROR")
+	defer os.Unsetenv("GREETING")
+	defer os.Unsetenv("LOG_LEVEL")
+
+	if err := s.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload - Expecting: nil; Got: %s", err)
+	}
+
+	cfg := s.Config().(*reloadTestConfig)
+	if cfg.Greeting != "hola" {
+		t.Errorf("Config - Expecting: hola; Got: %s", cfg.Greeting)
+	}
+
+	if first.Greeting != "hello" {
+		t.Errorf("Previous config - Expecting: hello; Got: %s", first.Greeting)
+	}
+
+	if s.LogLevel() != logger.ERROR {
+		t.Errorf("Log level - Expecting: ERROR; Got: %s", s.LogLevel())
+	}
+
+	if hooks != 1 {
+		t.Errorf("Reload hooks - Expecting: 1 call; Got: %d", hooks)
+	}
+}
+
+func TestReloadHookFailure(t *testing.T) {
+	s := newTestService(t)
+
+	var called bool
+	s.OnReload(func(ctx context.Context) error {
+		return errors.New("failed")
+	})
+	s.OnReload(func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+
+	if err := s.Reload(context.Background()); err == nil {
+		t.Errorf("Reload - Expecting: error; Got: nil")
+	}
+
+	if !called {
+		t.Errorf("Reload - Expecting the next hooks to be called")
+	}
+}
+
+func TestReloadHookRegistration(t *testing.T) {
+	s := newTestService(t)
+
+	var added int
+	s.OnReload(func(ctx context.Context) error {
+		s.OnReload(func(ctx context.Context) error {
+			added++
+			return nil
+		})
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Reload(context.Background())
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Reload - Expecting: nil; Got: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Reload - Expecting: hooks registering hooks; Got: deadlock")
+	}
+
+	if added != 0 {
+		t.Errorf("First reload - Expecting: the new hook not called; Got: %d calls", added)
+	}
+
+	s.Reload(context.Background())
+	if added != 1 {
+		t.Errorf("Second reload - Expecting: the new hook called; Got: %d calls", added)
+	}
+}
@@ -13,7 +13,8 @@ import (
 	"github.com/gorilla/schema"
 )
 
-// Unmarshal request into an object based on the request's content-type
+// Unmarshal request into an object based on the request's content-type.
+// When the body exceeds the route limit (see gohan.Route.BodyLimit), the error is a *http.MaxBytesError.
 func Unmarshal(r *http.Request, i interface{}) error {
 	contentType := r.Header.Get("Content-Type")
 	body, err := ioutil.ReadAll(r.Body)
@@ -0,0 +1,144 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag returns a strong entity tag for the body.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// WeakETag returns a weak entity tag for the body, for representations that are
+// equivalent but not byte for byte identical (e.g. compressed).
+func WeakETag(body []byte) string {
+	return "W/" + ETag(body)
+}
+
+// ETagBlob writes the body with its ETag, or a 304 response if the client already has it
+// (see NotModified). An ETag set before by the handler is kept.
+func ETagBlob(w http.ResponseWriter, req *http.Request, b []byte, code int) error {
+	if w.Header().Get("ETag") == "" {
+		w.Header().Set("ETag", ETag(b))
+	}
+
+	if code == http.StatusOK && NotModified(w, req) {
+		return nil
+	}
+
+	return Blob(w, b, code)
+}
+
+// ETagJSON is the ETagBlob version of JSON.
+func ETagJSON(w http.ResponseWriter, req *http.Request, data interface{}, code int) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	return ETagBlob(w, req, b, code)
+}
+
+// ETagXML is the ETagBlob version of XML.
+func ETagXML(w http.ResponseWriter, req *http.Request, data interface{}, code int) error {
+	b, err := xml.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Add("Content-Type", "application/xml; charset=UTF-8")
+	return ETagBlob(w, req, b, code)
+}
+
+// NotModified checks the If-None-Match and If-Modified-Since headers of a GET or HEAD
+// request against the ETag and Last-Modified headers of the response. When the client
+// already has the representation, it writes a 304 response and returns true.
+func NotModified(w http.ResponseWriter, req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	h := w.Header()
+	etag := h.Get("ETag")
+
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" || !matchETag(inm, etag, false) {
+			return false
+		}
+	} else if ims := req.Header.Get("If-Modified-Since"); ims != "" {
+		lastModified, err := http.ParseTime(h.Get("Last-Modified"))
+		if err != nil {
+			return false
+		}
+
+		since, err := http.ParseTime(ims)
+		if err != nil || lastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	// The 304 responses have the headers of a 200 response, without the content ones
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// PreconditionFailed checks the If-Match and If-Unmodified-Since headers of the request
+// against the current state of the resource, before modifying it (optimistic concurrency).
+// An empty etag means the resource doesn't exist. When a precondition fails, it writes
+// a 412 problem response and returns true.
+func PreconditionFailed(w http.ResponseWriter, req *http.Request, etag string, lastModified time.Time) bool {
+	if im := req.Header.Get("If-Match"); im != "" {
+		if etag != "" && matchETag(im, etag, true) {
+			return false
+		}
+	} else if ius := req.Header.Get("If-Unmodified-Since"); ius != "" {
+		since, err := http.ParseTime(ius)
+		if err != nil || lastModified.IsZero() || !lastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	Problem(w, http.StatusPreconditionFailed, "the resource was modified")
+	return true
+}
+
+// matchETag reports if the etag matches one of the list (or *). The strong comparison
+// never matches weak tags.
+func matchETag(list, etag string, strong bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strong && strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+
+		if strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -78,3 +78,33 @@ func Blob(w http.ResponseWriter, body []byte, code int) error {
 	_, err := w.Write(body)
 	return err
 }
+
+// ProblemDetails is the body of a problem response as defined by RFC 7807.
+type ProblemDetails struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// Problem writes a RFC 7807 problem response for the status code with the given detail.
+func Problem(w http.ResponseWriter, code int, detail string) error {
+	return ProblemJSON(w, ProblemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(code),
+		Status: code,
+		Detail: detail,
+	})
+}
+
+// ProblemJSON writes the problem using the application/problem+json content type.
+func ProblemJSON(w http.ResponseWriter, problem ProblemDetails) error {
+	b, err := json.Marshal(problem)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	return Blob(w, b, problem.Status)
+}
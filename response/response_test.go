@@ -1,3 +1,119 @@
 package response
 
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
 // TODO: write unit test
+
+func TestProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	Problem(w, http.StatusTooManyRequests, "slow down")
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Status - Expecting: 429; Got: %d", w.Code)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type - Expecting: application/problem+json; Got: %s", ct)
+	}
+
+	var problem ProblemDetails
+	json.Unmarshal(w.Body.Bytes(), &problem)
+
+	expected := ProblemDetails{Type: "about:blank", Title: "Too Many Requests", Status: 429, Detail: "slow down"}
+	if problem != expected {
+		t.Errorf("Body - Expecting: %+v; Got: %+v", expected, problem)
+	}
+}
+
+func TestETagJSON(t *testing.T) {
+	data := map[string]string{"name": "gohan"}
+
+	w := httptest.NewRecorder()
+	ETagJSON(w, httptest.NewRequest(http.MethodGet, "/", nil), data, http.StatusOK)
+
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("First request - Expecting: 200 with ETag; Got: %d %q", w.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+
+	w = httptest.NewRecorder()
+	ETagJSON(w, req, data, http.StatusOK)
+
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match - Expecting: 304 without body; Got: %d %q", w.Code, w.Body.String())
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "" {
+		t.Errorf("If-None-Match - Expecting: no Content-Type; Got: %s", ct)
+	}
+}
+
+func TestNotModifiedSince(t *testing.T) {
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := map[time.Time]int{
+		modified:                 http.StatusNotModified,
+		modified.Add(time.Hour):  http.StatusNotModified,
+		modified.Add(-time.Hour): http.StatusOK,
+	}
+
+	for since, expected := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("If-Modified-Since", since.Format(http.TimeFormat))
+
+		w := httptest.NewRecorder()
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		if !NotModified(w, req) {
+			w.WriteHeader(http.StatusOK)
+		}
+
+		if w.Code != expected {
+			t.Errorf("%s - Expecting: %d; Got: %d", since, expected, w.Code)
+		}
+	}
+}
+
+func TestPreconditionFailed(t *testing.T) {
+	etag := ETag([]byte("v1"))
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		header, value, etag string
+		failed              bool
+	}{
+		{"If-Match", etag, etag, false},
+		{"If-Match", `"a", ` + etag, etag, false},
+		{"If-Match", ETag([]byte("v0")), etag, true},
+		{"If-Match", "W/" + etag, etag, true},
+		{"If-Match", "*", etag, false},
+		{"If-Match", "*", "", true},
+		{"If-Unmodified-Since", modified.Format(http.TimeFormat), etag, false},
+		{"If-Unmodified-Since", modified.Add(-time.Hour).Format(http.TimeFormat), etag, true},
+		{"", "", etag, false},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/", nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+
+		w := httptest.NewRecorder()
+		if failed := PreconditionFailed(w, req, test.etag, modified); failed != test.failed {
+			t.Errorf("%s %s - Expecting: %t; Got: %t", test.header, test.value, test.failed, failed)
+		}
+
+		if test.failed && w.Code != http.StatusPreconditionFailed {
+			t.Errorf("%s %s - Expecting: 412; Got: %d", test.header, test.value, w.Code)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package gohan
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Route is a registered route. Its authorization requirements can be declared after
+// the registration:
+//
+//	service.DELETE("/users/:id", deleteUser).Authorize(gohan.RequireRoles("admin"))
+type Route struct {
+	Method  string
+	Pattern string
+	Handler string
+
+	group *Group
+
+	mu        sync.RWMutex
+	rules     []AuthRule
+	bodyLimit int64
+	timeout   time.Duration
+}
+
+// Authorize adds authorization rules to the route. They are checked along with
+// the rules of its groups.
+func (r *Route) Authorize(rules ...AuthRule) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rules = append(r.rules, rules...)
+	return r
+}
+
+// Rules returns the authorization rules of the route, the ones of its groups first.
+func (r *Route) Rules() []AuthRule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var rules []AuthRule
+	if r.group != nil {
+		rules = r.group.Rules()
+	}
+
+	return append(rules, r.rules...)
+}
+
+// RouteInfo describes a route for introspection. Routes without authorization rules
+// have an empty Authorization list.
+type RouteInfo struct {
+	Method        string
+	Pattern       string
+	Handler       string
+	Authorization []string
+}
+
+// Routes returns the routes of the service sorted by pattern and method.
+func (s *Service) Routes() []RouteInfo {
+	s.routesMu.RLock()
+	defer s.routesMu.RUnlock()
+
+	routes := make([]RouteInfo, 0, len(s.routes))
+	for _, route := range s.routes {
+		info := RouteInfo{
+			Method:        route.Method,
+			Pattern:       route.Pattern,
+			Handler:       route.Handler,
+			Authorization: []string{},
+		}
+
+		for _, rule := range route.Rules() {
+			info.Authorization = append(info.Authorization, rule.Name)
+		}
+
+		routes = append(routes, info)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern == routes[j].Pattern {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Pattern < routes[j].Pattern
+	})
+
+	return routes
+}
+
+// addRoute records the route for introspection.
+func (s *Service) addRoute(route *Route) {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	s.routes = append(s.routes, route)
+}
@@ -0,0 +1,93 @@
+package gohan
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Default values of the server configuration.
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+	DefaultShutdownTimeout   = 10 * time.Second
+)
+
+// ServerConfig contains the settings of the http servers started by the service.
+// A zero or negative timeout means no timeout, except for ShutdownTimeout which uses
+// DefaultShutdownTimeout. As option.WithServerConfig only sets the non-zero fields, a
+// negative value is needed to disable the default ReadHeaderTimeout and IdleTimeout.
+type ServerConfig struct {
+	// Host or IP the service binds to. Every interface is used when empty.
+	Host string
+
+	// See http.Server for the description of these fields.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+
+	// Maximum size in bytes of the request bodies, it can be overridden per route with
+	// Route.BodyLimit. A zero value, the default, means no limit.
+	MaxBodyBytes int64
+
+	// Time during which the readiness endpoint fails but the requests are still served
+	// before shutting down, so the load balancers can stop sending traffic to the service.
+	DrainDelay time.Duration
+
+	// Maximum time to wait for the in-flight requests to finish on shutdown.
+	ShutdownTimeout time.Duration
+
+	// Serves HTTP/2 without TLS (h2c) along with HTTP/1, e.g. behind a service mesh sidecar.
+	H2C bool
+
+	// Path of the unix socket to listen on instead of a tcp port.
+	UnixSocket string
+
+	// Permissions of the unix socket file. Defaults to DefaultUnixSocketMode.
+	UnixSocketMode os.FileMode
+
+	// Uses a listener inherited from systemd (socket activation) instead of creating one.
+	SocketActivation bool
+
+	// Name of the inherited listener (FileDescriptorName in the systemd socket unit).
+	// The first one is used when empty.
+	SocketActivationName string
+}
+
+// DefaultServerConfig returns the configuration used when none is provided.
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		ReadHeaderTimeout: DefaultReadHeaderTimeout,
+		IdleTimeout:       DefaultIdleTimeout,
+		ShutdownTimeout:   DefaultShutdownTimeout,
+	}
+}
+
+// newHTTPServer creates a http server for the handler using the service server configuration.
+func (s *Service) newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler: s.h2cHandler(handler),
+		// The requests get the values of the service context, not its cancellation
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithoutCancel(s.Context)
+		},
+		ReadTimeout:       s.Server.ReadTimeout,
+		ReadHeaderTimeout: s.Server.ReadHeaderTimeout,
+		WriteTimeout:      s.Server.WriteTimeout,
+		IdleTimeout:       s.Server.IdleTimeout,
+		MaxHeaderBytes:    s.Server.MaxHeaderBytes,
+	}
+}
+
+// shutdownTimeout returns the configured shutdown timeout or the default one.
+func (s *Service) shutdownTimeout() time.Duration {
+	if s.Server.ShutdownTimeout <= 0 {
+		return DefaultShutdownTimeout
+	}
+
+	return s.Server.ShutdownTimeout
+}
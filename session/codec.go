@@ -0,0 +1,144 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Key is a pair of keys used to protect the session cookies. The hash key signs the
+// cookie (HMAC-SHA256), it should be 32 or 64 random bytes. The optional block key
+// encrypts it (AES-GCM), it must be 16, 24 or 32 bytes.
+type Key struct {
+	Hash  []byte
+	Block []byte
+}
+
+var errInvalidCookie = errors.New("invalid session cookie")
+
+// codec signs and encrypts the cookie values. The first key encodes the values, all
+// of them are tried to decode them, so the keys can be rotated by adding a new one first.
+type codec struct {
+	keys []Key
+}
+
+func newCodec(keys []Key) (*codec, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("session - no keys were provided")
+	}
+
+	for i, key := range keys {
+		if len(key.Hash) == 0 {
+			return nil, fmt.Errorf("session - missing hash key %d", i)
+		}
+
+		if len(key.Block) > 0 {
+			if _, err := aes.NewCipher(key.Block); err != nil {
+				return nil, fmt.Errorf("session - invalid block key %d: %w", i, err)
+			}
+		}
+	}
+
+	return &codec{keys: keys}, nil
+}
+
+// encode returns <payload>.<signature>, the cookie name is signed along with the
+// payload so a value can't be used in another cookie.
+func (c *codec) encode(name string, value []byte) (string, error) {
+	key := c.keys[0]
+
+	if len(key.Block) > 0 {
+		var err error
+		if value, err = encrypt(key.Block, value); err != nil {
+			return "", err
+		}
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(value)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(sign(key.Hash, name, payload)), nil
+}
+
+func (c *codec) decode(name, encoded string) ([]byte, error) {
+	i := strings.LastIndex(encoded, ".")
+	if i < 0 {
+		return nil, errInvalidCookie
+	}
+
+	payload := encoded[:i]
+	signature, err := base64.RawURLEncoding.DecodeString(encoded[i+1:])
+	if err != nil {
+		return nil, errInvalidCookie
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidCookie
+	}
+
+	for _, key := range c.keys {
+		if !hmac.Equal(signature, sign(key.Hash, name, payload)) {
+			continue
+		}
+
+		if len(key.Block) == 0 {
+			return value, nil
+		}
+
+		return decrypt(key.Block, value)
+	}
+
+	return nil, errInvalidCookie
+}
+
+func sign(key []byte, name, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "." + payload))
+	return mac.Sum(nil)
+}
+
+func encrypt(key, value []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, value, nil), nil
+}
+
+func decrypt(key, value []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(value) < gcm.NonceSize() {
+		return nil, errInvalidCookie
+	}
+
+	plain, err := gcm.Open(nil, value[:gcm.NonceSize()], value[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errInvalidCookie
+	}
+
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
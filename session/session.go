@@ -0,0 +1,422 @@
+// Package session contains a middleware managing the user sessions.
+//
+// By default the session values are kept in a signed cookie, encrypted when a block
+// key is given. With a Store, the values are kept on the server and the cookie only
+// contains the signed session id:
+//
+//	sessions, err := session.New(session.Config{
+//		Keys:  []session.Key{{Hash: hashKey, Block: blockKey}},
+//		Store: session.NewSQLStore(db, ""),
+//	})
+//	...
+//	admin := service.Group("/admin", sessions)
+//	admin.GET("/", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+//		sess := session.FromContext(sc)
+//		user, _ := sess.Get("user").(string)
+//		...
+//	})
+//
+// The keys are rotated by adding the new key first, the cookies signed with the
+// previous keys are still accepted and re-signed with the new one.
+package session
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/response"
+)
+
+// Default values of the configuration.
+const (
+	DefaultCookieName      = "session"
+	DefaultIdleTimeout     = 30 * time.Minute
+	DefaultAbsoluteTimeout = 24 * time.Hour
+)
+
+// contextKey is the ServiceContext key of the session.
+const contextKey = "gohan.session"
+
+// Session is the session of a request. The values are JSON encoded, so they are read
+// back as JSON types (e.g. float64 for numbers).
+type Session struct {
+	mu sync.Mutex
+
+	id         string
+	values     map[string]interface{}
+	createdAt  time.Time
+	accessedAt time.Time
+
+	isNew     bool
+	modified  bool
+	destroyed bool
+	oldID     string
+}
+
+// record is the encoded form of a session.
+type record struct {
+	Values     map[string]interface{} `json:"v,omitempty"`
+	CreatedAt  time.Time              `json:"c"`
+	AccessedAt time.Time              `json:"a"`
+}
+
+// FromContext returns the session of the request, or nil when the session middleware
+// isn't used by the route.
+func FromContext(sc *gohan.ServiceContext) *Session {
+	s, _ := sc.Get(contextKey).(*Session)
+	return s
+}
+
+// ID returns the session id. It is empty for the cookie sessions.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.id
+}
+
+// IsNew reports if the session was created by the request.
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.isNew
+}
+
+// Get returns a value of the session, or nil.
+func (s *Session) Get(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.values[key]
+}
+
+// Set stores a value in the session.
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = value
+	s.modified = true
+}
+
+// Delete removes a value from the session.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.values, key)
+	s.modified = true
+}
+
+// Destroy removes the session, e.g. on logout.
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values = make(map[string]interface{})
+	s.destroyed = true
+}
+
+// RenewID gives a new id to the session, keeping its values. It should be called when
+// the privileges change (e.g. on login) to prevent session fixation.
+func (s *Session) RenewID() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.id == "" {
+		return nil
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	if s.oldID == "" && !s.isNew {
+		s.oldID = s.id
+	}
+	s.id = id
+	s.modified = true
+	return nil
+}
+
+func newID() (string, error) {
+	return gohan.GenerateRandomString(32)
+}
+
+// Config contains the settings of the middleware.
+type Config struct {
+	// Keys protecting the cookies, the first one is used to encode them.
+	Keys []Key
+
+	// Where the sessions are kept. When nil, the values are kept in the cookie which
+	// is limited to 4KB.
+	Store Store
+
+	// Cookie settings. The cookie is always HttpOnly, SameSite defaults to Lax.
+	CookieName string
+	Path       string
+	Domain     string
+	Secure     bool
+	SameSite   http.SameSite
+
+	// The session expires after being idle for IdleTimeout, or AbsoluteTimeout after
+	// its creation. Default to DefaultIdleTimeout and DefaultAbsoluteTimeout.
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+
+	// used by the tests
+	now func() time.Time
+}
+
+// New returns a middleware loading the session of the request, available with FromContext.
+// The session is saved before the response is written, a new session is only saved once
+// a value is set.
+func New(config Config) (gohan.MiddlewareFunc, error) {
+	codec, err := newCodec(config.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.CookieName == "" {
+		config.CookieName = DefaultCookieName
+	}
+
+	if config.Path == "" {
+		config.Path = "/"
+	}
+
+	if config.SameSite == 0 {
+		config.SameSite = http.SameSiteLaxMode
+	}
+
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = DefaultIdleTimeout
+	}
+
+	if config.AbsoluteTimeout <= 0 {
+		config.AbsoluteTimeout = DefaultAbsoluteTimeout
+	}
+
+	if config.now == nil {
+		config.now = time.Now
+	}
+
+	m := &manager{config: config, codec: codec}
+
+	return func(next gohan.HandlerFunc) gohan.HandlerFunc {
+		return func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+			sess, err := m.load(req)
+			if err != nil {
+				sc.Logger.Errorf("failed loading the session: %+v", err)
+				response.Problem(w, http.StatusInternalServerError, "failed loading the session")
+				return
+			}
+
+			sc.Set(contextKey, sess)
+
+			sw := &sessionWriter{ResponseWriter: w, save: func() {
+				if err := m.save(req, w, sess); err != nil {
+					sc.Logger.Errorf("failed saving the session: %+v", err)
+				}
+			}}
+
+			next(sc, sw, req)
+
+			// nothing was written by the handler
+			sw.commit()
+		}
+	}, nil
+}
+
+type manager struct {
+	config Config
+	codec  *codec
+}
+
+// load returns the session of the request, or a new one when it's missing, invalid
+// or expired.
+func (m *manager) load(req *http.Request) (*Session, error) {
+	now := m.config.now()
+	fresh := func() (*Session, error) {
+		sess := &Session{values: make(map[string]interface{}), createdAt: now, accessedAt: now, isNew: true}
+		if m.config.Store != nil {
+			id, err := newID()
+			if err != nil {
+				return nil, err
+			}
+			sess.id = id
+		}
+		return sess, nil
+	}
+
+	cookie, err := req.Cookie(m.config.CookieName)
+	if err != nil {
+		return fresh()
+	}
+
+	value, err := m.codec.decode(m.config.CookieName, cookie.Value)
+	if err != nil {
+		return fresh()
+	}
+
+	var id string
+	if m.config.Store != nil {
+		id = string(value)
+		if value, err = m.config.Store.Load(req.Context(), id); err != nil {
+			if err == ErrNotFound {
+				return fresh()
+			}
+			return nil, err
+		}
+	}
+
+	var r record
+	if err := json.Unmarshal(value, &r); err != nil {
+		return fresh()
+	}
+
+	if !now.Before(m.expiresAt(r.CreatedAt, r.AccessedAt)) {
+		return fresh()
+	}
+
+	if r.Values == nil {
+		r.Values = make(map[string]interface{})
+	}
+
+	return &Session{id: id, values: r.Values, createdAt: r.CreatedAt, accessedAt: r.AccessedAt}, nil
+}
+
+// expiresAt returns when the session expires, the earliest of the idle and absolute timeouts.
+func (m *manager) expiresAt(createdAt, accessedAt time.Time) time.Time {
+	idle := accessedAt.Add(m.config.IdleTimeout)
+	absolute := createdAt.Add(m.config.AbsoluteTimeout)
+
+	if idle.Before(absolute) {
+		return idle
+	}
+	return absolute
+}
+
+// save stores the session and writes its cookie. The existing sessions are saved on
+// every request to extend their idle timeout.
+func (m *manager) save(req *http.Request, w http.ResponseWriter, sess *Session) error {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	ctx := req.Context()
+	store := m.config.Store
+
+	if sess.destroyed {
+		if store != nil && !sess.isNew {
+			if err := store.Delete(ctx, sess.id); err != nil {
+				return err
+			}
+		}
+
+		if store != nil && sess.oldID != "" {
+			if err := store.Delete(ctx, sess.oldID); err != nil {
+				return err
+			}
+		}
+
+		m.setCookie(w, "", time.Time{})
+		return nil
+	}
+
+	if sess.isNew && !sess.modified {
+		return nil
+	}
+
+	sess.accessedAt = m.config.now()
+	expiresAt := m.expiresAt(sess.createdAt, sess.accessedAt)
+
+	value, err := json.Marshal(record{Values: sess.values, CreatedAt: sess.createdAt, AccessedAt: sess.accessedAt})
+	if err != nil {
+		return err
+	}
+
+	if store != nil {
+		if err := store.Save(ctx, sess.id, value, expiresAt); err != nil {
+			return err
+		}
+
+		if sess.oldID != "" {
+			if err := store.Delete(ctx, sess.oldID); err != nil {
+				return err
+			}
+			sess.oldID = ""
+		}
+
+		value = []byte(sess.id)
+	}
+
+	encoded, err := m.codec.encode(m.config.CookieName, value)
+	if err != nil {
+		return err
+	}
+
+	m.setCookie(w, encoded, expiresAt)
+	return nil
+}
+
+// setCookie writes the session cookie, an empty value removes it.
+func (m *manager) setCookie(w http.ResponseWriter, value string, expiresAt time.Time) {
+	cookie := &http.Cookie{
+		Name:     m.config.CookieName,
+		Value:    value,
+		Path:     m.config.Path,
+		Domain:   m.config.Domain,
+		Secure:   m.config.Secure,
+		HttpOnly: true,
+		SameSite: m.config.SameSite,
+	}
+
+	if value == "" {
+		cookie.MaxAge = -1
+	} else {
+		cookie.Expires = expiresAt
+	}
+
+	http.SetCookie(w, cookie)
+}
+
+// sessionWriter saves the session before the headers are written.
+type sessionWriter struct {
+	http.ResponseWriter
+	save      func()
+	committed bool
+}
+
+func (w *sessionWriter) commit() {
+	if !w.committed {
+		w.committed = true
+		w.save()
+	}
+}
+
+func (w *sessionWriter) WriteHeader(code int) {
+	w.commit()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.commit()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sessionWriter) Flush() {
+	w.commit()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original writer, see http.ResponseController.
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
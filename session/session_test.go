@@ -0,0 +1,212 @@
+package session
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appnaconda/gohan"
+	"github.com/appnaconda/gohan/internal/gohantest"
+)
+
+var (
+	hashKey  = []byte("0123456789abcdef0123456789abcdef")
+	blockKey = []byte("abcdef0123456789")
+)
+
+// newTestService returns a service counting the visits in the session.
+func newTestService(t *testing.T, config Config) *gohan.Service {
+	t.Helper()
+
+	s := gohantest.NewService(t)
+
+	sessions, err := New(config)
+	if err != nil {
+		t.Fatalf("New session - Expecting: nil; Got: %s", err)
+	}
+
+	g := s.Group("", sessions)
+
+	g.GET("/visit", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		sess := FromContext(sc)
+		visits, _ := sess.Get("visits").(float64)
+		sess.Set("visits", visits+1)
+		fmt.Fprint(w, visits+1)
+	})
+
+	g.GET("/login", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		FromContext(sc).RenewID()
+	})
+
+	g.GET("/logout", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {
+		FromContext(sc).Destroy()
+	})
+
+	g.GET("/anonymous", func(sc *gohan.ServiceContext, w http.ResponseWriter, req *http.Request) {})
+
+	return s
+}
+
+// get sends a request with the cookie and returns the response with the new cookie.
+func get(s *gohan.Service, path string, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	w := gohantest.Serve(s, req)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == DefaultCookieName {
+			return w, c
+		}
+	}
+
+	return w, cookie
+}
+
+func TestCookieSession(t *testing.T) {
+	s := newTestService(t, Config{Keys: []Key{{Hash: hashKey}}})
+
+	if _, cookie := get(s, "/anonymous", nil); cookie != nil {
+		t.Errorf("Anonymous - Expecting: no cookie; Got: %s", cookie)
+	}
+
+	_, cookie := get(s, "/visit", nil)
+	if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("Cookie - Expecting: HttpOnly Lax cookie; Got: %v", cookie)
+	}
+
+	w, cookie := get(s, "/visit", cookie)
+	if w.Body.String() != "2" {
+		t.Errorf("Second visit - Expecting: 2; Got: %s", w.Body.String())
+	}
+
+	// Tampered cookies start a new session
+	tampered := *cookie
+	tampered.Value = "x" + tampered.Value[1:]
+	if w, _ := get(s, "/visit", &tampered); w.Body.String() != "1" {
+		t.Errorf("Tampered cookie - Expecting: 1; Got: %s", w.Body.String())
+	}
+
+	// A cookie can't be used with another name
+	other := newTestService(t, Config{Keys: []Key{{Hash: hashKey}}, CookieName: "other"})
+	renamed := *cookie
+	renamed.Name = "other"
+	req := httptest.NewRequest(http.MethodGet, "/visit", nil)
+	req.AddCookie(&renamed)
+	w = gohantest.Serve(other, req)
+	if w.Body.String() != "1" {
+		t.Errorf("Renamed cookie - Expecting: 1; Got: %s", w.Body.String())
+	}
+
+	w, cookie = get(s, "/logout", cookie)
+	if cookie.MaxAge != -1 {
+		t.Errorf("Logout - Expecting: cookie removed; Got: %v", cookie)
+	}
+}
+
+func TestEncryptedSession(t *testing.T) {
+	s := newTestService(t, Config{Keys: []Key{{Hash: hashKey, Block: blockKey}}})
+
+	_, cookie := get(s, "/visit", nil)
+	if strings.Contains(cookie.Value, "eyJ2Ijp7InZpc2l0cyI6") {
+		t.Errorf("Encryption - Expecting: encrypted value; Got: %s", cookie.Value)
+	}
+
+	if w, _ := get(s, "/visit", cookie); w.Body.String() != "2" {
+		t.Errorf("Second visit - Expecting: 2; Got: %s", w.Body.String())
+	}
+
+	if _, err := New(Config{Keys: []Key{{Hash: hashKey, Block: []byte("short")}}}); err == nil {
+		t.Errorf("Invalid block key - Expecting: error; Got: nil")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := Key{Hash: []byte("old hash key"), Block: blockKey}
+	s := newTestService(t, Config{Keys: []Key{old}})
+	_, cookie := get(s, "/visit", nil)
+
+	s = newTestService(t, Config{Keys: []Key{{Hash: hashKey}, old}})
+	w, cookie := get(s, "/visit", cookie)
+	if w.Body.String() != "2" {
+		t.Errorf("Old key - Expecting: 2; Got: %s", w.Body.String())
+	}
+
+	// The cookie is signed with the new key
+	s = newTestService(t, Config{Keys: []Key{{Hash: hashKey}}})
+	if w, _ := get(s, "/visit", cookie); w.Body.String() != "3" {
+		t.Errorf("New key - Expecting: 3; Got: %s", w.Body.String())
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Now()
+	config := Config{
+		Keys:            []Key{{Hash: hashKey}},
+		IdleTimeout:     10 * time.Minute,
+		AbsoluteTimeout: time.Hour,
+		now:             func() time.Time { return now },
+	}
+	s := newTestService(t, config)
+
+	_, cookie := get(s, "/visit", nil)
+	if !cookie.Expires.Equal(now.Add(10 * time.Minute).Truncate(time.Second)) {
+		t.Errorf("Expires - Expecting: %s; Got: %s", now.Add(10*time.Minute), cookie.Expires)
+	}
+
+	// Every request extends the idle timeout, until the absolute one
+	for i := 2; i <= 7; i++ {
+		now = now.Add(9 * time.Minute)
+
+		var w *httptest.ResponseRecorder
+		w, cookie = get(s, "/visit", cookie)
+		if w.Body.String() != fmt.Sprint(i) {
+			t.Errorf("Visit %d - Expecting: %d; Got: %s", i, i, w.Body.String())
+		}
+	}
+
+	now = now.Add(9 * time.Minute)
+	if w, _ := get(s, "/visit", cookie); w.Body.String() != "1" {
+		t.Errorf("Absolute timeout - Expecting: 1; Got: %s", w.Body.String())
+	}
+
+	_, cookie = get(s, "/visit", nil)
+	now = now.Add(11 * time.Minute)
+	if w, _ := get(s, "/visit", cookie); w.Body.String() != "1" {
+		t.Errorf("Idle timeout - Expecting: 1; Got: %s", w.Body.String())
+	}
+}
+
+func TestStoreSession(t *testing.T) {
+	store := NewMemoryStore()
+	s := newTestService(t, Config{Keys: []Key{{Hash: hashKey}}, Store: store})
+
+	_, cookie := get(s, "/visit", nil)
+	w, cookie := get(s, "/visit", cookie)
+	if w.Body.String() != "2" || store.Len() != 1 {
+		t.Errorf("Second visit - Expecting: 2 and 1 session; Got: %s and %d", w.Body.String(), store.Len())
+	}
+
+	// The old id is removed from the store
+	_, renewed := get(s, "/login", cookie)
+	if renewed.Value == cookie.Value || store.Len() != 1 {
+		t.Errorf("RenewID - Expecting: new cookie and 1 session; Got: %s and %d", renewed.Value, store.Len())
+	}
+
+	if w, _ := get(s, "/visit", cookie); w.Body.String() != "1" {
+		t.Errorf("Old id - Expecting: 1; Got: %s", w.Body.String())
+	}
+
+	if w, _ := get(s, "/visit", renewed); w.Body.String() != "3" {
+		t.Errorf("New id - Expecting: 3; Got: %s", w.Body.String())
+	}
+
+	get(s, "/logout", renewed)
+	if w, _ := get(s, "/visit", renewed); w.Body.String() != "1" {
+		t.Errorf("After logout - Expecting: 1; Got: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,159 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by the stores when the session doesn't exist or is expired.
+var ErrNotFound = errors.New("session not found")
+
+// Store keeps the sessions on the server side, the cookie only contains the signed
+// session id. Implementations must be safe for concurrent use.
+type Store interface {
+	// Load returns the data of the session, or ErrNotFound.
+	Load(ctx context.Context, id string) ([]byte, error)
+
+	// Save creates or replaces the session. It can be removed after expiresAt.
+	Save(ctx context.Context, id string, data []byte, expiresAt time.Time) error
+
+	Delete(ctx context.Context, id string) error
+}
+
+type memoryEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// MemoryStore keeps the sessions in memory, they are lost on restart and aren't
+// shared between instances. The expired sessions are evicted.
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memoryEntry
+	lastSweep time.Time
+
+	// used by the tests
+	now func() time.Time
+}
+
+// DefaultSweepInterval is how often the memory store evicts the expired sessions.
+const DefaultSweepInterval = time.Minute
+
+// NewMemoryStore returns an empty memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]memoryEntry), now: time.Now}
+}
+
+// Load implements the Store interface.
+func (m *MemoryStore) Load(ctx context.Context, id string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.sessions[id]
+	if !ok || !m.now().Before(entry.expiresAt) {
+		return nil, ErrNotFound
+	}
+
+	return entry.data, nil
+}
+
+// Save implements the Store interface.
+func (m *MemoryStore) Save(ctx context.Context, id string, data []byte, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= DefaultSweepInterval {
+		m.lastSweep = now
+		for id, entry := range m.sessions {
+			if !now.Before(entry.expiresAt) {
+				delete(m.sessions, id)
+			}
+		}
+	}
+
+	m.sessions[id] = memoryEntry{data: data, expiresAt: expiresAt}
+	return nil
+}
+
+// Delete implements the Store interface.
+func (m *MemoryStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+// Len returns the number of sessions in the store.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.sessions)
+}
+
+// DefaultTable is the table used by the SQL store when none is configured.
+const DefaultTable = "sessions"
+
+// SQLStore keeps the sessions in a table of the service database (MySQL):
+//
+//	CREATE TABLE sessions (
+//		id         VARCHAR(64) NOT NULL PRIMARY KEY,
+//		data       BLOB        NOT NULL,
+//		expires_at DATETIME    NOT NULL,
+//		INDEX (expires_at)
+//	);
+//
+// The expired sessions aren't returned, see DeleteExpired to remove them.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLStore returns a store using the table. An empty table uses DefaultTable.
+func NewSQLStore(db *sql.DB, table string) *SQLStore {
+	if table == "" {
+		table = DefaultTable
+	}
+
+	return &SQLStore{db: db, table: table}
+}
+
+// Load implements the Store interface.
+func (s *SQLStore) Load(ctx context.Context, id string) ([]byte, error) {
+	var data []byte
+
+	err := s.db.QueryRowContext(ctx, "SELECT data FROM "+s.table+" WHERE id = ? AND expires_at > ?", id, time.Now().UTC()).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+// Save implements the Store interface.
+func (s *SQLStore) Save(ctx context.Context, id string, data []byte, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO "+s.table+" (id, data, expires_at) VALUES (?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE data = VALUES(data), expires_at = VALUES(expires_at)", id, data, expiresAt.UTC())
+	return err
+}
+
+// Delete implements the Store interface.
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM "+s.table+" WHERE id = ?", id)
+	return err
+}
+
+// DeleteExpired removes the expired sessions, e.g. from a background worker (see Service.Go).
+func (s *SQLStore) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM "+s.table+" WHERE expires_at <= ?", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,92 @@
+//go:build !windows
+
+package gohan
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunSignals(t *testing.T) {
+	s := newTestService(t)
+	s.Server.Host = "127.0.0.1"
+
+	reloaded := make(chan struct{}, 1)
+	s.OnReload(func(ctx context.Context) error {
+		reloaded <- struct{}{}
+		return nil
+	})
+
+	started := make(chan struct{})
+	s.OnStart(func(ctx context.Context) error {
+		close(started)
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(0)
+	}()
+
+	<-started
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("SIGHUP - Expecting the service to be reloaded")
+	}
+
+	select {
+	case <-done:
+		t.Fatalf("SIGHUP - Expecting the service to keep running")
+	default:
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("SIGTERM - Expecting: nil; Got: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("SIGTERM - Expecting the service to stop")
+	}
+}
+
+func TestRunSecondSignal(t *testing.T) {
+	s := newTestService(t)
+	s.Server.Host = "127.0.0.1"
+	s.Server.DrainDelay = time.Hour
+
+	started := make(chan struct{})
+	s.OnStart(func(ctx context.Context) error {
+		close(started)
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(0)
+	}()
+
+	<-started
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	for i := 0; i < 1000 && !s.Health.IsShuttingDown(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the second signal skips the drain delay
+	syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Second signal - Expecting the service to stop")
+	}
+}
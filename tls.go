@@ -0,0 +1,166 @@
+package gohan
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultTLSReloadInterval is how often the certificate files are checked for changes.
+const DefaultTLSReloadInterval = 30 * time.Second
+
+// TLSConfig contains the settings used to serve https.
+type TLSConfig struct {
+	// PEM encoded certificate and key files. They are reloaded when they change on disk.
+	CertFile string
+	KeyFile  string
+
+	// Base tls configuration. When no cert files are provided, its certificates are used as is.
+	Config *tls.Config
+
+	// PEM encoded bundle of the CAs used to verify the client certificates.
+	// Setting it enables mutual TLS. It is reloaded along with the certificate.
+	ClientCAFile string
+
+	// Client authentication policy when ClientCAFile is set. Defaults to tls.RequireAndVerifyClientCert.
+	ClientAuth tls.ClientAuthType
+
+	// How often the files are checked for changes. Defaults to DefaultTLSReloadInterval.
+	ReloadInterval time.Duration
+}
+
+// certReloader keeps the tls configuration in sync with the files on disk.
+type certReloader struct {
+	config TLSConfig
+
+	mu      sync.RWMutex
+	current *tls.Config
+	modTime time.Time
+}
+
+func newCertReloader(config TLSConfig) (*certReloader, error) {
+	if config.Config == nil && (config.CertFile == "" || config.KeyFile == "") {
+		return nil, fmt.Errorf("tls - a certificate and key files or a tls.Config are required")
+	}
+
+	r := &certReloader{config: config}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// TLSConfig returns the tls configuration used by the server. Every handshake
+// gets the last loaded certificate and client CAs.
+func (r *certReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.current, nil
+		},
+	}
+}
+
+// Reload reads the certificate, key and client CA files again.
+// The previous configuration is kept if any of them is invalid.
+func (r *certReloader) Reload() error {
+	var config *tls.Config
+	if r.config.Config != nil {
+		config = r.config.Config.Clone()
+	} else {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	if r.config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+		if err != nil {
+			return fmt.Errorf("tls - failed loading the certificate: %w", err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if r.config.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("tls - failed reading the client CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls - no valid certificate found in %s", r.config.ClientCAFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = r.config.ClientAuth
+		if config.ClientAuth == tls.NoClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	r.mu.Lock()
+	r.current = config
+	r.modTime = r.lastModTime()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// watch reloads the files when they change until the context is done.
+func (r *certReloader) watch(ctx context.Context, onError func(error)) {
+	if r.config.CertFile == "" && r.config.ClientCAFile == "" {
+		return
+	}
+
+	interval := r.config.ReloadInterval
+	if interval <= 0 {
+		interval = DefaultTLSReloadInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.mu.RLock()
+			changed := r.lastModTime().After(r.modTime)
+			r.mu.RUnlock()
+
+			if changed {
+				if err := r.Reload(); err != nil {
+					onError(err)
+				}
+			}
+		}
+	}
+}
+
+// lastModTime returns the most recent modification time of the files.
+func (r *certReloader) lastModTime() time.Time {
+	var last time.Time
+	for _, name := range []string{r.config.CertFile, r.config.KeyFile, r.config.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+
+		if info, err := os.Stat(name); err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+
+	return last
+}
@@ -0,0 +1,179 @@
+package gohan
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/appnaconda/gohan/response"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCert creates a certificate signed by the parent, or self signed if parent is nil.
+func newTestCert(t *testing.T, cn string, parent *testCert, serial int64) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+
+	if err := ioutil.WriteFile(certFile, c.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := newTestCert(t, "test-ca", nil, 1)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := newTestCert(t, "server", ca, 2).write(t, dir, "server")
+	client := newTestCert(t, "client", ca, 3)
+
+	s := newTestService(t)
+	s.TLS = &TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}
+	s.GET("/whoami", func(sc *ServiceContext, w http.ResponseWriter, req *http.Request) {
+		response.String(w, sc.ClientCertificateSubject, http.StatusOK)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Serve(ctx, ln)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{client.tlsCertificate()},
+	}}}
+
+	res, err := httpClient.Get("https://" + ln.Addr().String() + "/whoami")
+	if err != nil {
+		t.Fatalf("GET /whoami - Expecting: nil; Got: %s", err)
+	}
+	defer res.Body.Close()
+
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != "CN=client" {
+		t.Errorf("Client subject - Expecting: CN=client; Got: %s", body)
+	}
+
+	// Without a client certificate the handshake should fail
+	noCertClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if _, err := noCertClient.Get("https://" + ln.Addr().String() + "/whoami"); err == nil {
+		t.Errorf("Without client certificate - Expecting: error; Got: nil")
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := newTestCert(t, "test-ca", nil, 1)
+	certFile, keyFile := newTestCert(t, "first", ca, 2).write(t, dir, "server")
+
+	r, err := newCertReloader(TLSConfig{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("newCertReloader - Expecting: nil; Got: %s", err)
+	}
+
+	newTestCert(t, "second", ca, 3).write(t, dir, "server")
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload - Expecting: nil; Got: %s", err)
+	}
+
+	config, _ := r.TLSConfig().GetConfigForClient(nil)
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.Subject.CommonName != "second" {
+		t.Errorf("Reload - Expecting: second; Got: %s", cert.Subject.CommonName)
+	}
+
+	// An invalid file keeps the previous certificate
+	ioutil.WriteFile(certFile, []byte("invalid"), 0600)
+	if err := r.Reload(); err == nil {
+		t.Errorf("Reload invalid - Expecting: error; Got: nil")
+	}
+
+	if config, _ := r.TLSConfig().GetConfigForClient(nil); len(config.Certificates) != 1 {
+		t.Errorf("Reload invalid - Expecting the previous certificate to be kept")
+	}
+}
@@ -10,6 +10,12 @@ type Tracer interface {
 	HTTPHandler(http.Handler) http.Handler
 }
 
+// TracerFlusher is implemented by the tracers buffering spans. Flush is
+// called when the service shuts down.
+type TracerFlusher interface {
+	Flush(ctx context.Context) error
+}
+
 type Span interface {
 	NewChild(string) Span
 	SetLabel(k, v string)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sync"
 
 	"cloud.google.com/go/trace"
 	"github.com/appnaconda/gohan"
@@ -13,6 +14,9 @@ import (
 
 type tracer struct {
 	client *trace.Client
+
+	// uploads of the traces of the finished requests
+	uploads sync.WaitGroup
 }
 
 type span struct {
@@ -50,10 +54,38 @@ func (t *tracer) HTTPHandler(h http.Handler) http.Handler {
 		return h
 	}
 
-	return t.client.HTTPHandler(h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		root := t.client.SpanFromRequest(r)
+		defer func() {
+			// the trace is uploaded in the background, Flush waits for it
+			t.uploads.Add(1)
+			go func() {
+				defer t.uploads.Done()
+				root.FinishWait()
+			}()
+		}()
+
+		h.ServeHTTP(w, r.WithContext(trace.NewContext(r.Context(), root)))
+	})
+}
+
+// Flush waits for the upload of the traces of the finished requests.
+func (t *tracer) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		t.uploads.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (tracer) GetSpan(ctx context.Context) gohan.Span {
+func (*tracer) GetSpan(ctx context.Context) gohan.Span {
 	if ctx == nil {
 		return span{parent: nil}
 	}